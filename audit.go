@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// auditEntry is a line in the audit log, one per run that changed (or deleted)
+// items.
+type auditEntry struct {
+	Time     time.Time              `json:"time"`
+	User     string                 `json:"user"`               // local user@host
+	Identity string                 `json:"identity,omitempty"` // aws caller identity arn
+	Region   string                 `json:"region"`
+	Table    string                 `json:"table"`
+	Op       string                 `json:"op"`   // delete, inc, ...
+	Keys     int                    `json:"keys"` // items changed
+	Failed   int                    `json:"failed,omitempty"`
+	Flags    map[string]interface{} `json:"flags,omitempty"`
+}
+
+// auditPath returns the audit log location, --audit-log, or the audit file in
+// stateDir.
+func auditPath() string {
+	if auditlog != "" {
+		return auditlog
+	}
+
+	dir := stateDir()
+	if dir == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, "audit")
+}
+
+// localUser returns the local user, and host names, as user@host.
+func localUser() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	if h, err := os.Hostname(); err == nil {
+		name += "@" + h
+	}
+
+	return name
+}
+
+// audit appends a run that changed items of table to the audit log, and to
+// --audit-cloudwatch if set. Errors are only logged, the changes being done.
+func audit(table, op string, keys, failed int, flags map[string]interface{}) {
+	e := auditEntry{
+		Time:   time.Now().UTC(),
+		User:   localUser(),
+		Table:  table,
+		Op:     op,
+		Keys:   keys,
+		Failed: failed,
+		Flags:  flags,
+	}
+
+	sess, cnfs, err := newSession()
+	if err == nil {
+		stsc := sts.New(sess, cnfs...)
+		e.Region = aws.StringValue(stsc.Config.Region)
+		if id, err := stsc.GetCallerIdentity(&sts.GetCallerIdentityInput{}); err == nil {
+			e.Identity = aws.StringValue(id.Arn)
+		}
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	if err := appendAudit(auditPath(), b); err != nil {
+		log.Printf("audit: %v\n", err)
+	}
+
+	if auditcwl != "" && sess != nil {
+		if err := putAudit(sess, cnfs, auditcwl, b); err != nil {
+			log.Printf("audit: %v: %v\n", auditcwl, err)
+		}
+	}
+}
+
+// appendAudit appends a line to the audit log file.
+func appendAudit(file string, line []byte) error {
+	if file == "" {
+		return fmt.Errorf("no audit log location")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// putAudit sends a line to the cloudwatch logs destination, fmt: <group[:stream]>,
+// the stream being 'lsdy' if not set. The stream is created if needed.
+func putAudit(sess *session.Session, cnfs []*aws.Config, dest string, line []byte) error {
+	group, stream := dest, "lsdy"
+	if i := strings.Index(dest, ":"); i >= 0 {
+		group, stream = dest[:i], dest[i+1:]
+	}
+
+	cwl := cloudwatchlogs.New(sess, cnfs...)
+	_, err := cwl.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+	})
+
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+		return err
+	}
+
+	_, err = cwl.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+		LogEvents: []*cloudwatchlogs.InputLogEvent{{
+			Message:   aws.String(string(line)),
+			Timestamp: aws.Int64(time.Now().UnixMilli()),
+		}},
+	})
+
+	return err
+}
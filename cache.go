@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// cacheEntry is a --cache file (or a snapshot, see 'lsdy snapshot'): the fetched
+// items of a query, and the table description, so that --offline doesn't need
+// aws at all.
+type cacheEntry struct {
+	Time  time.Time
+	Query string // signature, see querySig
+	Table *dynamodb.DescribeTableOutput
+	Items []map[string]*dynamodb.AttributeValue
+}
+
+// MarshalJSON encodes the items as dynamodb json, see avJSON.
+func (e *cacheEntry) MarshalJSON() ([]byte, error) {
+	type entry cacheEntry // without this method
+	items := make([]map[string]interface{}, len(e.Items))
+	for i, item := range e.Items {
+		items[i] = avItem(item)
+	}
+
+	return json.Marshal(struct {
+		*entry
+		Items []map[string]interface{}
+	}{(*entry)(e), items})
+}
+
+// avJSON returns v as dynamodb json, i.e. {"S":"a"}, without the null fields
+// that json.Marshal would include. Empty strings and lists, and false booleans,
+// are kept as is. It decodes back into a dynamodb.AttributeValue with
+// json.Unmarshal.
+func avJSON(v *dynamodb.AttributeValue) map[string]interface{} {
+	out := make(map[string]interface{})
+	switch {
+	case v.B != nil:
+		out["B"] = v.B
+	case v.BOOL != nil:
+		out["BOOL"] = *v.BOOL
+	case v.BS != nil:
+		out["BS"] = v.BS
+	case v.L != nil:
+		l := make([]interface{}, len(v.L))
+		for i, e := range v.L {
+			l[i] = avJSON(e)
+		}
+
+		out["L"] = l
+	case v.M != nil:
+		out["M"] = avItem(v.M)
+	case v.N != nil:
+		out["N"] = *v.N
+	case v.NS != nil:
+		out["NS"] = v.NS
+	case v.NULL != nil:
+		out["NULL"] = *v.NULL
+	case v.S != nil:
+		out["S"] = *v.S
+	case v.SS != nil:
+		out["SS"] = v.SS
+	}
+
+	return out
+}
+
+// avItem returns item as dynamodb json, see avJSON.
+func avItem(item map[string]*dynamodb.AttributeValue) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range item {
+		out[k] = avJSON(v)
+	}
+
+	return out
+}
+
+// cacheDir returns the --cache location, $XDG_CACHE_HOME/lsdy, or ~/.cache/lsdy.
+func cacheDir() string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+
+		dir = filepath.Join(home, ".cache")
+	}
+
+	return filepath.Join(dir, "lsdy")
+}
+
+// querySig returns what identifies the items fetched for table: where from, and
+// the flags that change what is fetched (the rest is applied on display).
+func querySig(table string) string {
+	return fmt.Sprint(region, profile, rolearn, table, pk, sk, skbetw, transact, limit, keylimit, skip, index, filters, expiring, keysonly)
+}
+
+// cacheFile returns the cache file of a query signature.
+func cacheFile(sig string) string {
+	sum := sha256.Sum256([]byte(sig))
+	return filepath.Join(cacheDir(), hex.EncodeToString(sum[:16])+".json")
+}
+
+// readCache returns the cached items of a query signature.
+func readCache(sig string) (*cacheEntry, error) {
+	var e cacheEntry
+	if err := readJSON(cacheFile(sig), &e); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no cached items for this query (see --cache)")
+		}
+
+		return nil, err
+	}
+
+	if e.Query != sig { // unlikely
+		return nil, fmt.Errorf("%v: signature mismatch", cacheFile(sig))
+	}
+
+	return &e, nil
+}
+
+// readJSON decodes file into v.
+func readJSON(file string, v interface{}) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+
+	return nil
+}
+
+// writeJSON encodes v into file, replacing it atomically.
+func writeJSON(file string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/term"
+)
+
+var colorNames = map[string]int{
+	"black":   tablewriter.FgBlackColor,
+	"red":     tablewriter.FgRedColor,
+	"green":   tablewriter.FgGreenColor,
+	"yellow":  tablewriter.FgYellowColor,
+	"blue":    tablewriter.FgBlueColor,
+	"magenta": tablewriter.FgMagentaColor,
+	"cyan":    tablewriter.FgCyanColor,
+	"white":   tablewriter.FgWhiteColor,
+	"gray":    tablewriter.FgHiBlackColor,
+	"bold":    tablewriter.Bold,
+}
+
+// useColor returns true if the table output should be colorized, based on
+// --color, --no-color, and the NO_COLOR environment variable.
+func useColor() bool {
+	if nocolor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	switch colorf {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		return pipecmd == "" && term.IsTerminal(int(os.Stdout.Fd()))
+	}
+}
+
+// colorRule is a parsed --color-rule value, fmt: <attr:regex:color[+color...]>.
+// Rows whose attr value matches regex are displayed in that color.
+type colorRule struct {
+	attr   string
+	re     *regexp.Regexp
+	colors tablewriter.Colors
+}
+
+func parseColorRule(v string) (*colorRule, error) {
+	// The regex can have colons, so the color is the last segment.
+	i, j := strings.Index(v, ":"), strings.LastIndex(v, ":")
+	if i <= 0 || j == i {
+		return nil, usageErrorf("invalid --color-rule format: %v", v)
+	}
+
+	re, err := regexp.Compile(v[i+1 : j])
+	if err != nil {
+		return nil, usageErrorf("invalid --color-rule regex: %v", err)
+	}
+
+	rule := &colorRule{attr: v[:i], re: re}
+	for _, name := range strings.Split(v[j+1:], "+") {
+		c, ok := colorNames[name]
+		if !ok {
+			return nil, usageErrorf("unknown --color-rule color: %v", name)
+		}
+
+		rule.colors = append(rule.colors, c)
+	}
+
+	return rule, nil
+}
+
+// rowColors returns the per-cell colors of the n'th (0-based) row: --watch marks
+// first, then the first matching rule wins, otherwise alternating rows are
+// shaded if --zebra is set.
+func rowColors(n int, r lsdy.Row, rules []*colorRule, cols int) []tablewriter.Colors {
+	var c tablewriter.Colors
+	switch r.Mark {
+	case "+":
+		c = tablewriter.Colors{tablewriter.FgGreenColor}
+	case "~":
+		c = tablewriter.Colors{tablewriter.FgYellowColor}
+	case "-":
+		c = tablewriter.Colors{tablewriter.FgRedColor}
+	}
+
+	for _, rule := range rules {
+		if c != nil {
+			break
+		}
+
+		if v, ok := r.Item[rule.attr]; ok && rule.re.MatchString(fmtval(v)) {
+			c = rule.colors
+		}
+	}
+
+	if c == nil && zebra && n%2 == 1 {
+		c = tablewriter.Colors{tablewriter.FgHiBlackColor}
+	}
+
+	out := make([]tablewriter.Colors, cols)
+	for i := range out {
+		out[i] = c
+	}
+
+	return out
+}
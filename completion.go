@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion <bash|zsh|fish|powershell>",
+	Short: "generate the shell completion script",
+	Long: `Generate the completion script for the given shell. Besides the subcommands and
+flags, table names (the <table> argument), attribute names (--attr, --sort-by),
+and index names (--index) are completed by calling ListTables/DescribeTable (and
+scanning a few items for the attribute names) with the credentials/endpoint flags
+in the command line, or the config file. For example:
+
+  # bash, in ~/.bashrc:
+  source <(lsdy completion bash)
+
+  # zsh, in ~/.zshrc (after compinit):
+  source <(lsdy completion zsh)
+
+  # fish:
+  lsdy completion fish > ~/.config/fish/completions/lsdy.fish`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		default:
+			return fmt.Errorf("unsupported shell: %v", args[0])
+		}
+	},
+}
+
+// completeTimeout bounds the aws calls made while completing.
+const completeTimeout = 5 * time.Second
+
+// completeService returns the dynamodb client to complete with, and the table
+// prefix of the current env, if any. For the commands that parse their own flags,
+// args (the flags included) are parsed first, and the positional ones returned.
+func completeService(cmd *cobra.Command, args []string) (*dynamodb.DynamoDB, string, []string, error) {
+	fs := cmd.Flags()
+	if cmd.DisableFlagParsing {
+		fs = cmdFlags(cmd)
+		if err := fs.Parse(args); err != nil {
+			return nil, "", nil, err
+		}
+
+		args = fs.Args()
+	}
+
+	var prefix string
+	if cfgfile != "" {
+		var err error
+		prefix, err = loadConfig(rootCmd.Flags(), cfgfile, false)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	svc, err := newService()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// Better no completion than a stuck shell.
+	hc := http.Client{}
+	if svc.Config.HTTPClient != nil {
+		hc = *svc.Config.HTTPClient
+	}
+
+	hc.Timeout = completeTimeout
+	svc.Config.HTTPClient = &hc
+	svc.Config.MaxRetries = aws.Int(1)
+	return svc, prefix, args, nil
+}
+
+// completeTables completes the <table> argument with the table names (without
+// the table prefix of the current env).
+func completeTables(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	svc, prefix, args, err := completeService(cmd, args)
+	if err != nil || len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	err = svc.ListTablesPages(&dynamodb.ListTablesInput{}, func(out *dynamodb.ListTablesOutput, last bool) bool {
+		for _, v := range out.TableNames {
+			name := aws.StringValue(v)
+			if strings.HasPrefix(name, prefix+toComplete) {
+				names = append(names, strings.TrimPrefix(name, prefix))
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+	}
+
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeIndexes completes --index with the secondary indexes of the table.
+func completeIndexes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	svc, prefix, args, err := completeService(cmd, args)
+	if err != nil || len(args) == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	t, err := svc.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(prefix + args[0])})
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, v := range t.Table.GlobalSecondaryIndexes {
+		names = append(names, aws.StringValue(v.IndexName))
+	}
+
+	for _, v := range t.Table.LocalSecondaryIndexes {
+		names = append(names, aws.StringValue(v.IndexName))
+	}
+
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeAttrs completes the last element of a comma-separated list of attribute
+// names (i.e. --attr), with the key attributes of the table, and the attributes of
+// a few of its items (since the others are not part of the table description).
+func completeAttrs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	svc, prefix, args, err := completeService(cmd, args)
+	if err != nil || len(args) == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	table := prefix + args[0]
+	t, err := svc.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	seen := make(map[string]bool)
+	for _, v := range t.Table.AttributeDefinitions {
+		seen[aws.StringValue(v.AttributeName)] = true
+	}
+
+	out, err := svc.Scan(&dynamodb.ScanInput{TableName: aws.String(table), Limit: aws.Int64(20)})
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+	} else {
+		for _, item := range out.Items {
+			for k := range item {
+				seen[k] = true
+			}
+		}
+	}
+
+	// Complete the last element, after the ones already given.
+	done, last := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		done, last = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	given := make(map[string]bool)
+	for _, v := range strings.Split(done, ",") {
+		given[v] = true
+	}
+
+	var names []string
+	for k := range seen {
+		if !given[k] && strings.HasPrefix(k, last) {
+			names = append(names, done+k)
+		}
+	}
+
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// registerCompletions sets up the live completions of the commands that take a
+// <table> argument.
+func registerCompletions() {
+	rootCmd.ValidArgsFunction = completeTables
+	for _, c := range []*cobra.Command{shellCmd, tailCmd, snapshotCmd, exportCmd, ddlCmd, workbenchCmd, iacCmd, replLagCmd, insightsCmd, hotkeysCmd, costCmd, incCmd, updateItemCmd, createItemCmd, importCmd} {
+		c.ValidArgsFunction = completeTables
+	}
+
+	for name, fn := range map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+		"attr":     completeAttrs,
+		"sort-by":  completeAttrs,
+		"index":    completeIndexes,
+		"template": completeTemplates,
+	} {
+		rootCmd.RegisterFlagCompletionFunc(name, fn)
+	}
+}
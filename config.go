@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configPath returns the default config file location,
+// $XDG_CONFIG_HOME/lsdy/config.yaml, or ~/.config/lsdy/config.yaml.
+func configPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "lsdy", "config.yaml")
+}
+
+// readConfig reads the config file. A missing file is not an error unless must
+// is true.
+func readConfig(file string, must bool) (map[string]interface{}, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) && !must {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var cfg map[string]interface{}
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+
+	return cfg, nil
+}
+
+// loadConfig sets the flags that are not set in the command line from the config
+// file, if it exists. The file is a map of flag names to values, or lists of
+// values for repeatable flags, i.e.
+//
+//	region: ap-northeast-1
+//	maxlen: payload=60,*=30
+//	transform:
+//	  - created_at:ts
+//	  - payload:b64|json
+//
+// Saved queries (see 'lsdy save') are kept under 'queries'. Environments, which
+// are sets of flag values applied by --env (over the defaults above), are kept
+// under 'envs', i.e.
+//
+//	envs:
+//	  prod:
+//	    region: us-east-1
+//	    rolearn: arn:aws:iam::111111111111:role/readonly
+//	    table_prefix: prod-
+//
+// The directory of the '--template @name' files is 'templates' (relative to the
+// config file, unless absolute), i.e. a team's shared one:
+//
+//	templates: /shared/lsdy/templates
+//
+// fs is the root flag set, also for the subcommands, so that the file only sets
+// the root flags, and never a subcommand's own flag of the same name (i.e. the
+// --format of 'lsdy export'). The environment's table_prefix, if any, is
+// returned.
+func loadConfig(fs *pflag.FlagSet, file string, must bool) (string, error) {
+	cfg, err := readConfig(file, must)
+	if err != nil {
+		return "", err
+	}
+
+	name, _ := cfg["env"].(string)
+	if f := fs.Lookup("env"); f != nil && f.Changed {
+		name = f.Value.String()
+	}
+
+	var prefix string
+	if name != "" {
+		envs, _ := cfg["envs"].(map[string]interface{})
+		env, ok := envs[name].(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%v: env not found: %v", file, name)
+		}
+
+		prefix, _ = env["table_prefix"].(string)
+		delete(env, "table_prefix")
+		if err := setFlags(fs, env, "env "+name); err != nil {
+			return "", err
+		}
+	}
+
+	if dir, ok := cfg["templates"].(string); ok {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(file), dir)
+		}
+
+		if _, ok := cfg["templates-dir"]; !ok {
+			cfg["templates-dir"] = dir
+		}
+	}
+
+	delete(cfg, "templates")
+	delete(cfg, "queries")
+	delete(cfg, "envs")
+	return prefix, setFlags(fs, cfg, file)
+}
+
+// cmdFlags returns a flag set of the root flags, and the flags of cmd, for the
+// subcommands that parse their own flags. A flag of cmd takes the place of the
+// root flag of the same name, if any.
+func cmdFlags(cmd *cobra.Command) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(cmd.Name(), pflag.ContinueOnError)
+	fs.Usage = func() {} // the parse errors are returned
+	fs.AddFlagSet(cmd.Flags())
+	fs.AddFlagSet(rootCmd.Flags()) // skips the names already added
+	return fs
+}
+
+// setFlags sets the flags in vals (flag name to value, or list of values) that are
+// not set yet. src is used in error messages.
+func setFlags(fs *pflag.FlagSet, vals map[string]interface{}, src string) error {
+	for name, v := range vals {
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%v: unknown flag: %v", src, name)
+		}
+
+		if f.Changed {
+			continue
+		}
+
+		list, ok := v.([]interface{})
+		if !ok {
+			list = []interface{}{v}
+		}
+
+		for _, val := range list {
+			if err := fs.Set(name, fmt.Sprintf("%v", val)); err != nil {
+				return fmt.Errorf("%v: %v: %v", src, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// changedFlags returns the flags set in fs, in setFlags' vals format. Credentials
+// and the flags named in skip are left out.
+func changedFlags(fs *pflag.FlagSet, skip ...string) map[string]interface{} {
+	skip = append(skip, "key", "secret")
+	vals := make(map[string]interface{})
+	fs.VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return // reset in the shell
+		}
+
+		for _, s := range skip {
+			if f.Name == s {
+				return
+			}
+		}
+
+		switch v := f.Value.(type) {
+		case pflag.SliceValue:
+			vals[f.Name] = v.GetSlice()
+		default:
+			if f.Value.Type() == "bool" {
+				b, _ := strconv.ParseBool(f.Value.String())
+				vals[f.Name] = b
+				return
+			}
+
+			vals[f.Name] = f.Value.String()
+		}
+	})
+
+	return vals
+}
+
+// saveQuery adds (or replaces) the named query under 'queries' in the config
+// file, keeping the rest of the file (including comments) as is.
+func saveQuery(file, name string, query map[string]interface{}) error {
+	var doc yaml.Node
+	b, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}},
+		}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%v: not a map", file)
+	}
+
+	queries := mapValue(root, "queries")
+	if queries == nil {
+		queries = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "queries"}, queries)
+	}
+
+	var qn yaml.Node
+	if err := qn.Encode(query); err != nil {
+		return err
+	}
+
+	if v := mapValue(queries, name); v != nil {
+		*v = qn
+	} else {
+		queries.Content = append(queries.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, &qn)
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, out.Bytes(), 0644)
+}
+
+// loadQuery returns the named query from the config file.
+func loadQuery(file, name string) (map[string]interface{}, error) {
+	cfg, err := readConfig(file, true)
+	if err != nil {
+		return nil, err
+	}
+
+	queries, _ := cfg["queries"].(map[string]interface{})
+	query, ok := queries[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v: query not found: %v", file, name)
+	}
+
+	return query, nil
+}
+
+// mapValue returns the value node of key in the mapping node m, or nil.
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	costsnce time.Duration
+	costscan bool
+	costexp  bool
+	costprc  string
+
+	costCmd = &cobra.Command{
+		Use:   "cost <table> [flags]",
+		Short: "estimate the monthly storage, and throughput cost of the table",
+		Long: `Estimate the monthly cost of the table, and its global secondary indexes, from
+their size, billing mode, provisioned capacity, and the capacity consumed (in
+CloudWatch) over the last --since, extrapolated to a month (730 hours). For a
+provisioned table, the on-demand cost of the same consumption is printed along,
+for comparison. With --scan (or --export), the cost of a full scan of the table
+(or of an export to S3) is added.
+
+The prices are the us-east-1 list prices of the standard table class (and the
+storage price of the standard-ia class for those tables), in USD; set the ones
+of your region, or contract, with --prices, i.e. 'storage=0.285,rru=0.1425'.
+Free tiers, reserved capacity, backups, streams, and data transfer are not
+included. The size, and item count of a table are only updated every six hours
+or so.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               costQueryCmd,
+	}
+)
+
+// costPrices are the default prices, in USD, see costCmd.
+var costPrices = map[string]float64{
+	"storage":    0.25,    // per GB-month
+	"storage-ia": 0.10,    // per GB-month, standard-ia table class
+	"rru":        0.125,   // per million on-demand read request units
+	"wru":        0.625,   // per million on-demand write request units
+	"rcu":        0.00013, // per provisioned RCU-hour
+	"wcu":        0.00065, // per provisioned WCU-hour
+	"export":     0.10,    // per GB exported to s3
+}
+
+// parsePrices returns the prices, with the --prices overrides.
+func parsePrices(v string) (map[string]float64, error) {
+	prices := make(map[string]float64)
+	for k, p := range costPrices {
+		prices[k] = p
+	}
+
+	if strings.TrimSpace(v) == "" {
+		return prices, nil
+	}
+
+	for _, s := range strings.Split(v, ",") {
+		sp := strings.SplitN(strings.TrimSpace(s), "=", 2)
+		if len(sp) != 2 {
+			return nil, usageErrorf("invalid --prices format: %v", v)
+		}
+
+		if _, ok := prices[sp[0]]; !ok {
+			var names []string
+			for k := range prices {
+				names = append(names, k)
+			}
+
+			sort.Strings(names)
+			return nil, usageErrorf("invalid --prices name: %v (expecting %v)", sp[0], strings.Join(names, ", "))
+		}
+
+		p, err := strconv.ParseFloat(sp[1], 64)
+		if err != nil || p < 0 {
+			return nil, usageErrorf("invalid --prices value: %v", s)
+		}
+
+		prices[sp[0]] = p
+	}
+
+	return prices, nil
+}
+
+// monthHours is the hours in an average month, as in the aws pricing.
+const monthHours = 730
+
+func costQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	log.SetFlags(0)
+	if costsnce < time.Hour || costsnce > 60*24*time.Hour {
+		return usageErrorf("invalid --since value: %v (expecting 1h to 60 days)", costsnce)
+	}
+
+	prices, err := parsePrices(costprc)
+	if err != nil {
+		return err
+	}
+
+	table := aws.StringValue(t.TableName)
+	ondemand := t.BillingModeSummary != nil && aws.StringValue(t.BillingModeSummary.BillingMode) == dynamodb.BillingModePayPerRequest
+	class := dynamodb.TableClassStandard
+	if t.TableClassSummary != nil && t.TableClassSummary.TableClass != nil {
+		class = aws.StringValue(t.TableClassSummary.TableClass)
+	}
+
+	// Storage, with the 100 bytes of overhead per item (of the table, and each
+	// index).
+	bytes := aws.Int64Value(t.TableSizeBytes) + 100*aws.Int64Value(t.ItemCount)
+	var rcu, wcu int64
+	if p := t.ProvisionedThroughput; p != nil {
+		rcu, wcu = aws.Int64Value(p.ReadCapacityUnits), aws.Int64Value(p.WriteCapacityUnits)
+	}
+
+	indexes := []string{""}
+	for _, v := range t.GlobalSecondaryIndexes {
+		bytes += aws.Int64Value(v.IndexSizeBytes) + 100*aws.Int64Value(v.ItemCount)
+		if p := v.ProvisionedThroughput; p != nil {
+			rcu += aws.Int64Value(p.ReadCapacityUnits)
+			wcu += aws.Int64Value(p.WriteCapacityUnits)
+		}
+
+		indexes = append(indexes, aws.StringValue(v.IndexName))
+	}
+
+	for _, v := range t.LocalSecondaryIndexes {
+		bytes += aws.Int64Value(v.IndexSizeBytes) + 100*aws.Int64Value(v.ItemCount)
+	}
+
+	// The consumed capacity of the table, and its global secondary indexes,
+	// extrapolated to a month.
+	sess, cnfs, err := newSession()
+	if err != nil {
+		return err
+	}
+
+	cw := cloudwatch.New(sess, cnfs...)
+	scale := monthHours * float64(time.Hour) / float64(costsnce)
+	var reads, writes float64
+	for _, idx := range indexes {
+		r, err := metricSeries(cw, table, idx, "ConsumedReadCapacityUnits", costsnce, 3600)
+		if err != nil {
+			return err
+		}
+
+		w, err := metricSeries(cw, table, idx, "ConsumedWriteCapacityUnits", costsnce, 3600)
+		if err != nil {
+			return err
+		}
+
+		reads += seriesSum(r) * scale
+		writes += seriesSum(w) * scale
+	}
+
+	gb := float64(bytes) / (1 << 30)
+	storage := prices["storage"]
+	if class == dynamodb.TableClassStandardInfrequentAccess {
+		storage = prices["storage-ia"]
+		log.Println("warning: the throughput prices are of the standard table class, see --prices")
+	}
+
+	mode := "on-demand"
+	if !ondemand {
+		mode = "provisioned"
+	}
+
+	fmt.Printf("%v (%v, %v, %v), consumption of the last %v:\n", table, aws.StringValue(svc.Config.Region), mode, strings.ToLower(class), costsnce)
+	odreads, odwrites := reads/1e6*prices["rru"], writes/1e6*prices["wru"]
+	total := gb * storage
+	fmt.Printf("  %-8v  %-30v  %10.2f\n", "storage", fmt.Sprintf("%.2f GB", gb), gb*storage)
+	if ondemand {
+		fmt.Printf("  %-8v  %-30v  %10.2f\n", "reads", fmt.Sprintf("%.2fM read request units", reads/1e6), odreads)
+		fmt.Printf("  %-8v  %-30v  %10.2f\n", "writes", fmt.Sprintf("%.2fM write request units", writes/1e6), odwrites)
+		total += odreads + odwrites
+	} else {
+		preads, pwrites := float64(rcu)*monthHours*prices["rcu"], float64(wcu)*monthHours*prices["wcu"]
+		fmt.Printf("  %-8v  %-30v  %10.2f  (consumed %.2fM, %.2f on-demand)\n", "reads", fmt.Sprintf("%v RCU provisioned", rcu), preads, reads/1e6, odreads)
+		fmt.Printf("  %-8v  %-30v  %10.2f  (consumed %.2fM, %.2f on-demand)\n", "writes", fmt.Sprintf("%v WCU provisioned", wcu), pwrites, writes/1e6, odwrites)
+		total += preads + pwrites
+	}
+
+	fmt.Printf("  %-8v  %-30v  %10.2f USD/month\n", "total", "", total)
+
+	// A full scan reads the table (not the indexes), eventually consistent.
+	if e, ok := lsdy.EstimateScan(t, &lsdy.Scan{Table: table}); costscan && ok {
+		fmt.Printf("\nfull scan: ~%v pages, ~%.2fM read units, %.2f USD on-demand", e.Pages, e.RCU/1e6, e.RCU/1e6*prices["rru"])
+		if p := t.ProvisionedThroughput; !ondemand && p != nil && aws.Int64Value(p.ReadCapacityUnits) > 0 {
+			trcu := aws.Int64Value(p.ReadCapacityUnits)
+			fmt.Printf(", or ~%v at the %v RCU provisioned", (time.Duration(e.RCU/float64(trcu)) * time.Second).Round(time.Second), trcu)
+		}
+
+		fmt.Println()
+	} else if costscan {
+		log.Printf("%v: no size information yet, for the full scan\n", table)
+	}
+
+	if costexp {
+		tgb := float64(aws.Int64Value(t.TableSizeBytes)) / (1 << 30)
+		fmt.Printf("\nexport to s3: %.2f GB, %.2f USD (needs point-in-time recovery, and consumes no capacity)\n", tgb, tgb*prices["export"])
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/spf13/cobra"
+)
+
+var (
+	newitem string
+
+	createItemCmd = &cobra.Command{
+		Use:   "create-item <table> --item <json> [--pk <attr:value>] [--sk <attr:value>]",
+		Short: "put an item only if it doesn't exist yet",
+		Long: `Put the --item (a json object, '-' to read it from stdin) into the table, with
+the --pk (and --sk) key attributes if set, only if no item with the same key
+exists (attribute_not_exists), and print whether it was created, or already
+existed. Both are a success, so that seeding scripts can be run again.
+
+Json numbers are stored as numbers, objects as maps, and arrays as lists.
+
+  lsdy create-item tenants --pk id:acme --item '{"plan":"free","seats":5}'`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               createItemQueryCmd,
+	}
+)
+
+// jsonAV returns the attribute value of v, decoded from json with UseNumber.
+func jsonAV(v interface{}) *dynamodb.AttributeValue {
+	switch v := v.(type) {
+	case json.Number:
+		return &dynamodb.AttributeValue{N: aws.String(v.String())}
+	case string:
+		return &dynamodb.AttributeValue{S: aws.String(v)}
+	case bool:
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(v)}
+	case []interface{}:
+		l := make([]*dynamodb.AttributeValue, len(v))
+		for i, e := range v {
+			l[i] = jsonAV(e)
+		}
+
+		return &dynamodb.AttributeValue{L: l}
+	case map[string]interface{}:
+		m := make(map[string]*dynamodb.AttributeValue)
+		for k, e := range v {
+			m[k] = jsonAV(e)
+		}
+
+		return &dynamodb.AttributeValue{M: m}
+	}
+
+	return &dynamodb.AttributeValue{NULL: aws.Bool(true)}
+}
+
+func createItemQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	src := []byte(newitem)
+	switch newitem {
+	case "":
+		return usageErrorf("--item cannot be empty")
+	case "-":
+		src, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+
+	var obj map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(src))
+	d.UseNumber()
+	if err := d.Decode(&obj); err != nil {
+		return usageErrorf("invalid --item: %v (expecting a json object)", err)
+	}
+
+	item := jsonAV(obj).M
+	if len(pk) > 0 {
+		key, err := keyFlags(t)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range key {
+			item[k] = v
+		}
+	}
+
+	// The key, as stored, for the messages.
+	var key []string
+	for _, k := range t.KeySchema {
+		name := aws.StringValue(k.AttributeName)
+		v, ok := item[name]
+		if !ok {
+			return usageErrorf("the key attribute %v is missing, see --item, or --pk/--sk", name)
+		}
+
+		for _, val := range avJSON(v) {
+			key = append(key, fmt.Sprintf("%v:%v", name, val))
+		}
+	}
+
+	hash, _ := keyNames(t.KeySchema)
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name(hash))).Build()
+	if err != nil {
+		return err
+	}
+
+	table := aws.StringValue(t.TableName)
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName:                t.TableName,
+		Item:                     item,
+		ConditionExpression:      expr.Condition(),
+		ExpressionAttributeNames: expr.Names(),
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		fmt.Printf("exists: %v\n", strings.Join(key, ", "))
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	audit(table, "create-item", 1, 0, changedFlags(cmdFlags(cmd), "config", "no-history"))
+	var attrs []string
+	for k := range item {
+		attrs = append(attrs, k)
+	}
+
+	sort.Strings(attrs)
+	fmt.Printf("created: %v (%v)\n", strings.Join(key, ", "), strings.Join(attrs, ", "))
+	return nil
+}
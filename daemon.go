@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dmevery time.Duration
+	dmquery string
+	dmout   string
+	dmdiff  bool
+	dmrotmb int
+	dmkeep  int
+
+	daemonCmd = &cobra.Command{
+		Use:   "daemon --every <interval> --query <name> [flags]",
+		Short: "run a saved query on a schedule, appending the rows (or changes) to rotating json lines files",
+		Long: `Run a query saved by 'lsdy save' every --every interval, until interrupted (or
+terminated), and append the resulting rows to a json lines file, one object per
+row, i.e.
+
+  {"time":"...","query":"stuck-jobs","item":{...}}
+
+With --diff, only the rows that are new (+), changed (~), or removed (-) since the
+previous run are appended (all of them on the first run), with a "change" field.
+The file is rotated by size (file.1 being the newest rotated file). Flags in the
+command line take precedence over the saved ones, as with 'lsdy run'.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               daemonQueryCmd,
+	}
+)
+
+// daemonState is the output of 'lsdy daemon', written to at the end of each run.
+type daemonState struct {
+	w    *rotFile
+	rows int // written so far
+}
+
+// write appends rows to the output file, see daemonCmd and rowsink.
+func (d *daemonState) write(rows []lsdy.Row, full func(lsdy.Row) map[string]interface{}) error {
+	now := time.Now().UTC()
+	for _, r := range rows {
+		if dmdiff && wstate.n > 0 && r.Mark == "" {
+			continue
+		}
+
+		v := map[string]interface{}{
+			"time":  now,
+			"query": dmquery,
+			"item":  full(r),
+		}
+
+		if dmdiff && wstate.n > 0 {
+			v["change"] = r.Mark
+		}
+
+		line, err := lsdy.JSON(v)
+		if err != nil {
+			return err
+		}
+
+		if _, err := d.w.Write([]byte(line + "\n")); err != nil {
+			return err
+		}
+
+		d.rows++
+	}
+
+	return nil
+}
+
+// rotFile is an append-only file rotated by size: name, name.1 (newest), ...,
+// name.<keep>.
+type rotFile struct {
+	name string
+	max  int64 // 0 means no rotation
+	keep int
+	f    *os.File
+	size int64
+}
+
+func openRotFile(name string, max int64, keep int) (*rotFile, error) {
+	r := &rotFile{name: name, max: max, keep: keep}
+	return r, r.open()
+}
+
+func (r *rotFile) open() error {
+	f, err := os.OpenFile(r.name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if p doesn't fit.
+func (r *rotFile) Write(p []byte) (int, error) {
+	if r.max > 0 && r.size > 0 && r.size+int64(len(p)) > r.max {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	if r.keep < 1 {
+		os.Remove(r.name)
+	} else {
+		for i := r.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%v.%v", r.name, i), fmt.Sprintf("%v.%v", r.name, i+1))
+		}
+
+		if err := os.Rename(r.name, r.name+".1"); err != nil {
+			return err
+		}
+	}
+
+	return r.open()
+}
+
+func (r *rotFile) Close() error { return r.f.Close() }
+
+func daemonQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := cmdFlags(cmd)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() > 1 {
+		return usageErrorf("expecting [table]")
+	}
+
+	switch {
+	case dmquery == "":
+		return usageErrorf("--query cannot be empty")
+	case dmevery <= 0:
+		return usageErrorf("--every cannot be empty")
+	case del:
+		return usageErrorf("--delete is not supported with daemon")
+	case watch > 0:
+		return usageErrorf("--watch is not supported with daemon")
+	}
+
+	log.SetFlags(0)
+	table, err := applyQuery(fs, dmquery, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if dmout == "" {
+		dmout = dmquery + ".ndjson"
+	}
+
+	w, err := openRotFile(dmout, int64(dmrotmb)<<20, dmkeep)
+	if err != nil {
+		return err
+	}
+
+	defer w.Close()
+	quiet, nohist = true, true
+	dm := &daemonState{w: w}
+	rowsink = dm.write
+	if dmdiff {
+		wstate = &watchState{}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for n := 1; ; n++ {
+		before := dm.rows
+		if err := run(rootCmd, []string{table}); err != nil {
+			log.Printf("run %v: %v\n", n, err)
+		} else {
+			log.Printf("run %v: %v rows written to %v (%v)\n", n, dm.rows-before, dmout, time.Now().Format(time.RFC3339))
+		}
+
+		if wstate != nil {
+			wstate.n++
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(dmevery):
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ddlfmt  string
+	ddlloc  string
+	ddlname string
+	sample  int64
+
+	ddlCmd = &cobra.Command{
+		Use:   "ddl <table> [flags]",
+		Short: "generate the athena (or glue) table definition of the table's export to s3",
+		Long: `Infer the schema of the table from a sample of its items (a scan of --sample
+items), and print the Athena CREATE EXTERNAL TABLE statement (or, with --format
+glue, the Glue TableInput json, for 'aws glue create-table --table-input') that
+reads the table's export to S3 (DynamoDB JSON format), i.e.
+
+  SELECT item.id.s, item.status.s FROM mytable WHERE item.status.s = 'failed'
+
+Each attribute is a struct of the DynamoDB JSON types seen for it in the sample
+(s, n, bool, m, l, etc.), so attributes with mixed types are kept. Attributes not
+in the sample are not in the schema; increase --sample for sparse attributes.
+--location is the data/ directory of the export.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               ddlQueryCmd,
+	}
+)
+
+// tableArg parses the flags of a subcommand taking a <table>, and returns the
+// client, and the description of the table (after the table prefix).
+func tableArg(cmd *cobra.Command, args []string) (*dynamodb.DynamoDB, *dynamodb.TableDescription, error) {
+	fs := cmdFlags(cmd)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, usageError(err)
+	}
+
+	if fs.NArg() != 1 {
+		return nil, nil, usageErrorf("expecting <table>")
+	}
+
+	var prefix string
+	if cfgfile != "" {
+		var err error
+		prefix, err = loadConfig(rootCmd.Flags(), cfgfile, fs.Changed("config") || envname != "")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	svc, err := newService()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := describeTable(svc, prefix+fs.Arg(0))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return svc, t.Table, nil
+}
+
+// sampleItems is tableArg, along with the first n items of the table (of a scan).
+func sampleItems(cmd *cobra.Command, args []string, n int64) (*dynamodb.TableDescription, []map[string]*dynamodb.AttributeValue, error) {
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if n < 1 {
+		return nil, nil, usageErrorf("invalid --sample value: %v", n)
+	}
+
+	items, err := (&lsdy.Scan{Table: aws.StringValue(t.TableName), Limit: n}).Run(svc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t, items, nil
+}
+
+// avSchema is the inferred type of an attribute: the DynamoDB JSON types seen for
+// it, and the schema of its map entries, and list elements.
+type avSchema struct {
+	types map[string]bool // S, N, B, BOOL, NULL, SS, NS, BS, M, L
+	m     map[string]*avSchema
+	l     *avSchema
+}
+
+func newAvSchema() *avSchema {
+	return &avSchema{types: make(map[string]bool), m: make(map[string]*avSchema)}
+}
+
+// add merges the type of v into s.
+func (s *avSchema) add(v *dynamodb.AttributeValue) {
+	switch {
+	case v.S != nil:
+		s.types["S"] = true
+	case v.N != nil:
+		s.types["N"] = true
+	case v.B != nil:
+		s.types["B"] = true
+	case v.BOOL != nil:
+		s.types["BOOL"] = true
+	case v.NULL != nil:
+		s.types["NULL"] = true
+	case v.SS != nil:
+		s.types["SS"] = true
+	case v.NS != nil:
+		s.types["NS"] = true
+	case v.BS != nil:
+		s.types["BS"] = true
+	case v.M != nil:
+		s.types["M"] = true
+		addItem(s.m, v.M)
+	case v.L != nil:
+		s.types["L"] = true
+		if s.l == nil {
+			s.l = newAvSchema()
+		}
+
+		for _, e := range v.L {
+			s.l.add(e)
+		}
+	}
+}
+
+// addItem merges the attribute types of item into m.
+func addItem(m map[string]*avSchema, item map[string]*dynamodb.AttributeValue) {
+	for k, v := range item {
+		if m[k] == nil {
+			m[k] = newAvSchema()
+		}
+
+		m[k].add(v)
+	}
+}
+
+// hiveScalar are the hive types of the scalar (and set) DynamoDB JSON types;
+// numbers are kept as strings, as in the export.
+var hiveScalar = map[string]string{
+	"S":    "string",
+	"N":    "string",
+	"B":    "string",
+	"BOOL": "boolean",
+	"NULL": "boolean",
+	"SS":   "array<string>",
+	"NS":   "array<string>",
+	"BS":   "array<string>",
+}
+
+// hive returns the hive type of s, i.e. struct<s:string,n:string>.
+func (s *avSchema) hive() string {
+	var types []string
+	for k := range s.types {
+		types = append(types, k)
+	}
+
+	sort.Strings(types)
+	var fields []string
+	for _, k := range types {
+		switch k {
+		case "M":
+			if len(s.m) == 0 {
+				fields = append(fields, "m:map<string,string>") // only empty maps seen
+				continue
+			}
+
+			fields = append(fields, "m:"+hiveStruct(s.m))
+		case "L":
+			if len(s.l.types) == 0 {
+				fields = append(fields, "l:array<string>") // only empty lists seen
+				continue
+			}
+
+			fields = append(fields, "l:array<"+s.l.hive()+">")
+		default:
+			fields = append(fields, strings.ToLower(k)+":"+hiveScalar[k])
+		}
+	}
+
+	return "struct<" + strings.Join(fields, ",") + ">"
+}
+
+// hiveStruct returns the hive struct of the attributes in m, sorted by name.
+func hiveStruct(m map[string]*avSchema) string {
+	var names []string
+	for k := range m {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	var fields []string
+	for _, k := range names {
+		fields = append(fields, hiveName(k)+":"+m[k].hive())
+	}
+
+	return "struct<" + strings.Join(fields, ",") + ">"
+}
+
+var hivePlain = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// hiveName returns the attribute name, quoted with backticks if needed.
+func hiveName(name string) string {
+	if hivePlain.MatchString(name) {
+		return name
+	}
+
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+var athenaName = regexp.MustCompile(`[^a-z0-9_]`)
+
+func ddlQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	t, items, err := sampleItems(cmd, args, sample)
+	if err != nil {
+		return err
+	}
+
+	if ddlfmt != "athena" && ddlfmt != "glue" {
+		return usageErrorf("invalid --format value: %v", ddlfmt)
+	}
+
+	table := aws.StringValue(t.TableName)
+	if len(items) == 0 {
+		return fmt.Errorf("%v: no items to infer the schema from", table)
+	}
+
+	schema := make(map[string]*avSchema)
+	for _, item := range items {
+		addItem(schema, item)
+	}
+
+	name := ddlname
+	if name == "" {
+		name = athenaName.ReplaceAllString(strings.ToLower(table), "_")
+	}
+
+	typ := hiveStruct(schema)
+	if ddlfmt == "athena" {
+		fmt.Printf("-- inferred from %v items of %v\n", len(items), table)
+		fmt.Printf("CREATE EXTERNAL TABLE IF NOT EXISTS `%v` (\n  item %v\n)\n", name, typ)
+		fmt.Println("ROW FORMAT SERDE 'org.openx.data.jsonserde.JsonSerDe'")
+		fmt.Printf("LOCATION '%v';\n", ddlloc)
+		return nil
+	}
+
+	in := map[string]interface{}{
+		"Name":       name,
+		"TableType":  "EXTERNAL_TABLE",
+		"Parameters": map[string]string{"classification": "json", "compressionType": "gzip"},
+		"StorageDescriptor": map[string]interface{}{
+			"Columns":      []map[string]string{{"Name": "item", "Type": typ}},
+			"Location":     ddlloc,
+			"InputFormat":  "org.apache.hadoop.mapred.TextInputFormat",
+			"OutputFormat": "org.apache.hadoop.hive.ql.io.HiveIgnoreKeyTextOutputFormat",
+			"SerdeInfo":    map[string]string{"SerializationLibrary": "org.openx.data.jsonserde.JsonSerDe"},
+		},
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(in)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+)
+
+// debugf logs to stderr if the --verbose level is at least lvl.
+func debugf(lvl int, format string, v ...interface{}) {
+	if verbose >= lvl {
+		log.Printf("[debug] "+format, v...)
+	}
+}
+
+// redact hides all but the last 4 characters of a secret.
+func redact(v string) string {
+	if v == "" {
+		return ""
+	}
+
+	return (&lsdy.Mask{Suffix: 4}).Apply(v)
+}
+
+// traceRequests logs the api calls sent through svc: the operation and its page
+// number, the item counts, whether there are more pages (LastEvaluatedKey), and
+// the latency. At -vv, the request parameters are logged as well.
+func traceRequests(svc *dynamodb.DynamoDB) {
+	pages := make(map[string]int)
+	svc.Handlers.Send.PushFront(func(r *request.Request) {
+		debugf(1, "%v: sending, attempt %v", r.Operation.Name, r.RetryCount+1)
+		debugf(2, "%v: params: %v", r.Operation.Name, r.Params)
+	})
+
+	svc.Handlers.Complete.PushBack(func(r *request.Request) {
+		name := r.Operation.Name
+		took := time.Since(r.Time).Round(time.Millisecond)
+		if r.Error != nil {
+			debugf(1, "%v: failed after %v: %v", name, took, r.Error)
+			return
+		}
+
+		var count, scanned int64
+		var more bool
+		switch out := r.Data.(type) {
+		case *dynamodb.QueryOutput:
+			count, scanned = aws.Int64Value(out.Count), aws.Int64Value(out.ScannedCount)
+			more = len(out.LastEvaluatedKey) > 0
+		case *dynamodb.ScanOutput:
+			count, scanned = aws.Int64Value(out.Count), aws.Int64Value(out.ScannedCount)
+			more = len(out.LastEvaluatedKey) > 0
+		default:
+			debugf(1, "%v: done in %v", name, took)
+			return
+		}
+
+		pages[name]++
+		debugf(1, "%v: page %v, items=%v, scanned=%v, LastEvaluatedKey=%v, took %v",
+			name, pages[name], count, scanned, more, took)
+	})
+}
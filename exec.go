@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// execSpec is a parsed --transform-exec value, fmt: <attr:command>.
+type execSpec struct {
+	attr string
+	cmd  string
+}
+
+func parseExec(v string) (*execSpec, error) {
+	i := strings.Index(v, ":")
+	if i <= 0 || strings.TrimSpace(v[i+1:]) == "" {
+		return nil, usageErrorf("invalid --transform-exec format: %v", v)
+	}
+
+	return &execSpec{attr: v[:i], cmd: v[i+1:]}, nil
+}
+
+// parseExecs parses the --transform-exec values.
+func parseExecs(vals []string) ([]*execSpec, error) {
+	var out []*execSpec
+	for _, v := range vals {
+		spec, err := parseExec(v)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, spec)
+	}
+
+	return out, nil
+}
+
+// run pipes vals through the command, one value per line (embedded newlines are
+// escaped as '\n'), in batches of n values (0 means all at once). The command is
+// expected to output exactly one line per input line, in the same order.
+func (e *execSpec) run(vals []string, n int) ([]string, error) {
+	if n <= 0 {
+		n = len(vals)
+	}
+
+	var out []string
+	for len(vals) > 0 {
+		cnt := n
+		if cnt > len(vals) {
+			cnt = len(vals)
+		}
+
+		res, err := e.batch(vals[:cnt])
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, res...)
+		vals = vals[cnt:]
+	}
+
+	return out, nil
+}
+
+func (e *execSpec) batch(vals []string) ([]string, error) {
+	var in bytes.Buffer
+	r := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+	for _, v := range vals {
+		in.WriteString(r.Replace(v))
+		in.WriteByte('\n')
+	}
+
+	c := exec.Command("sh", "-c", e.cmd)
+	c.Stdin = &in
+	c.Stderr = os.Stderr
+	b, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("transform-exec [%v]: %v", e.cmd, err)
+	}
+
+	var out []string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		out = append(out, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("transform-exec [%v]: %v", e.cmd, err)
+	}
+
+	if len(out) != len(vals) {
+		return nil, fmt.Errorf("transform-exec [%v]: expected %d output lines, got %d", e.cmd, len(vals), len(out))
+	}
+
+	return out, nil
+}
+
+// execValues runs the values of items through specs, upfront, in batches of n
+// values, and returns the outputs, by attribute, and value. Commands on the same
+// attribute are chained.
+func execValues(specs []*execSpec, n int, items []map[string]interface{}) (map[string]map[string]string, error) {
+	execd := make(map[string]map[string]string) // key=attr, val=(key=in, val=out)
+	for _, spec := range specs {
+		var vals, ins []string
+		uniq := make(map[string]struct{})
+		prev, chained := execd[spec.attr]
+		for _, item := range items {
+			v, ok := item[spec.attr]
+			if !ok {
+				continue
+			}
+
+			val := fmtval(v)
+			if _, ok := uniq[val]; ok {
+				continue
+			}
+
+			uniq[val] = struct{}{}
+			vals = append(vals, val)
+			if chained { // output of a previous command on the same attribute
+				ins = append(ins, prev[val])
+			} else {
+				ins = append(ins, val)
+			}
+		}
+
+		outs, err := spec.run(ins, n)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make(map[string]string)
+		for i, v := range vals {
+			next[v] = outs[i]
+		}
+
+		execd[spec.attr] = next
+	}
+
+	return execd, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Exit codes, so that scripts can branch on the kind of failure (see README).
+const (
+	exitFailed      = 1  // any other error
+	exitUsage       = 2  // invalid flags, or arguments
+	exitAuth        = 3  // no (or invalid, or expired) credentials, or access denied
+	exitNotFound    = 4  // table (or index, or item) not found
+	exitThrottled   = 5  // still throttled after retrying
+	exitEmpty       = 6  // no matching rows, with --fail-empty
+	exitDelete      = 7  // some of the --delete deletes failed
+	exitInterrupted = 8  // stopped by Ctrl-C or --timeout, the output is partial
+	exitInvalid     = 9  // some of the items failed --validate, or check-refs
+	exitScanMax     = 10 // scan refused, over --scan-max-rcu
+)
+
+// codeError is an error with the exit code to use, see exitCode.
+type codeError struct {
+	code int
+	err  error
+}
+
+func (e *codeError) Error() string { return e.err.Error() }
+func (e *codeError) Unwrap() error { return e.err }
+
+// usageErrorf returns an invalid flags (or arguments) error.
+func usageErrorf(format string, a ...interface{}) error {
+	return &codeError{exitUsage, fmt.Errorf(format, a...)}
+}
+
+// usageError marks err as an invalid flags (or arguments) error.
+func usageError(err error) error {
+	return &codeError{exitUsage, err}
+}
+
+// authCodes are the aws error codes of missing, invalid, or insufficient
+// credentials.
+var authCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"UnrecognizedClientException": true,
+	"InvalidClientTokenId":        true,
+	"InvalidSignatureException":   true,
+	"IncompleteSignature":         true,
+	"MissingAuthenticationToken":  true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"NoCredentialProviders":       true,
+	"EmptyStaticCreds":            true,
+	"SharedCredsLoad":             true,
+}
+
+// exitCode returns the exit code of err, by its codeError, or its aws error code.
+func exitCode(err error) int {
+	var ce *codeError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch {
+		case authCodes[aerr.Code()]:
+			return exitAuth
+		case aerr.Code() == dynamodb.ErrCodeResourceNotFoundException:
+			return exitNotFound
+		case request.IsErrorThrottle(aerr):
+			return exitThrottled
+		}
+	}
+
+	return exitFailed
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// parseWindow parses the value of --expiring, a duration, or a number of days,
+// i.e. '36h', '7d'.
+func parseWindow(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(strings.TrimSuffix(v, "d")); err == nil && strings.HasSuffix(v, "d") && n > 0 {
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, usageErrorf("invalid --expiring value: %v", v)
+	}
+
+	return d, nil
+}
+
+// ttlAttr returns the ttl attribute of table, or an error if ttl is not enabled.
+func ttlAttr(svc *dynamodb.DynamoDB, table string) (string, error) {
+	out, err := svc.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{TableName: aws.String(table)})
+	if err != nil {
+		return "", err
+	}
+
+	d := out.TimeToLiveDescription
+	if aws.StringValue(d.TimeToLiveStatus) != dynamodb.TimeToLiveStatusEnabled {
+		return "", fmt.Errorf("%v: ttl is %v, nothing is scheduled to expire", table, strings.ToLower(aws.StringValue(d.TimeToLiveStatus)))
+	}
+
+	return aws.StringValue(d.AttributeName), nil
+}
+
+// expiringCond returns the filter of the items that expire before end,
+// including the ones already expired but not deleted yet.
+func expiringCond(attr string, end time.Time) expression.ConditionBuilder {
+	return expression.Name(attr).LessThanEqual(expression.Value(end.Unix()))
+}
+
+// logExpiry logs the number of items expiring each day (local time), and of the
+// items already expired, pending deletion.
+func logExpiry(m []map[string]interface{}, attr, window string) {
+	now := time.Now()
+	days := make(map[string]int)
+	var pending int
+	for _, v := range m {
+		var sec float64
+		switch t := v[attr].(type) {
+		case float64:
+			sec = t
+		case json.Number:
+			sec, _ = t.Float64()
+		default:
+			continue
+		}
+
+		at := time.Unix(int64(sec), 0)
+		if at.Before(now) {
+			pending++
+			continue
+		}
+
+		days[at.Local().Format("2006-01-02 Mon")]++
+	}
+
+	var keys []string
+	for k := range days {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	log.Printf("expiring within %v (ttl attribute %v), by day:\n", window, attr)
+	if pending > 0 {
+		log.Printf("  expired, pending deletion: %v\n", pending)
+	}
+
+	for _, k := range keys {
+		log.Printf("  %v: %v\n", k, days[k])
+	}
+}
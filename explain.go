@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+)
+
+var exprRef = regexp.MustCompile(`[#:][A-Za-z0-9_]+`)
+
+// readable returns expr with its #name and :value placeholders substituted, i.e.
+// 'status <> "done"'.
+func readable(expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	return exprRef.ReplaceAllStringFunc(expr, func(ref string) string {
+		if n, ok := names[ref]; ok {
+			return *n
+		}
+
+		if v, ok := values[ref]; ok {
+			var i interface{}
+			if err := dynamodbattribute.Unmarshal(v, &i); err == nil {
+				if s, err := lsdy.JSON(i); err == nil {
+					return s
+				}
+			}
+		}
+
+		return ref
+	})
+}
+
+// exprLine writes an expression as sent, and with its placeholders substituted
+// on the next line.
+func exprLine(w io.Writer, label string, expr *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) {
+	if expr == nil {
+		fmt.Fprintf(w, "  %-24v-\n", label+":")
+		return
+	}
+
+	fmt.Fprintf(w, "  %-24v%v\n", label+":", *expr)
+	fmt.Fprintf(w, "  %-24v%v\n", "", readable(*expr, names, values))
+}
+
+// pageSize describes the page size of a request, and the total limit.
+func pageSize(size *int64, limit int64) string {
+	s := "up to 1 MB per page"
+	if size != nil {
+		s = fmt.Sprintf("%v items (or 1 MB) per page", *size)
+	}
+
+	if limit > 0 {
+		return fmt.Sprintf("%v, stops after %v items", s, limit)
+	}
+
+	return s + ", all pages"
+}
+
+// explainQuery writes the Query requests of q to w, see --explain.
+func explainQuery(w io.Writer, q *lsdy.Query) error {
+	ins, err := q.Inputs()
+	if err != nil {
+		return err
+	}
+
+	for i, in := range ins {
+		fmt.Fprintf(w, "explain: Query %v/%v on %v\n", i+1, len(ins), target(in.TableName, in.IndexName))
+		exprLine(w, "KeyConditionExpression", in.KeyConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		exprLine(w, "FilterExpression", in.FilterExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		exprLine(w, "ProjectionExpression", in.ProjectionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		order := "descending"
+		if aws.BoolValue(in.ScanIndexForward) {
+			order = "ascending"
+		}
+
+		fmt.Fprintf(w, "  %-24v%v\n", "Sort key order:", order)
+		fmt.Fprintf(w, "  %-24v%v\n", "Page size:", pageSize(in.Limit, q.Limit))
+	}
+
+	if q.Total > 0 {
+		fmt.Fprintf(w, "explain: stops after %v items in total\n", q.Total)
+	}
+
+	return nil
+}
+
+// explainScan writes the Scan request of s to w, see --explain.
+func explainScan(w io.Writer, s *lsdy.Scan) error {
+	in, err := s.Input()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "explain: Scan on %v (no --pk, reads every item)\n", target(in.TableName, in.IndexName))
+	exprLine(w, "FilterExpression", in.FilterExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	exprLine(w, "ProjectionExpression", in.ProjectionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	fmt.Fprintf(w, "  %-24v%v\n", "Page size:", pageSize(in.Limit, s.Limit))
+	return nil
+}
+
+func target(table, index *string) string {
+	if index == nil {
+		return fmt.Sprintf("table %v", *table)
+	}
+
+	return fmt.Sprintf("index %v of table %v", *index, *table)
+}
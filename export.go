@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exout string
+	exfmt string
+	exres string
+
+	exportCmd = &cobra.Command{
+		Use:   "export <table> --out <file> [flags]",
+		Short: "export a query (or scan) to csv or json lines, page by page, for tables larger than memory",
+		Long: `Export the items of a query (or scan) to a csv or json lines file. Each page is
+filtered, transformed, and written as soon as it is fetched, and then dropped, so
+tables far larger than memory can be exported. The display flags (--attr,
+--contains, --transform, --mask, etc.) apply; the ones that need all the rows at
+once (--sort-by, --top, --bottom, --dedupe) are not supported.
+
+The format is json lines (one item per line, as with --detail), or csv if --out
+ends with '.csv' (or with --format csv). Without --attr, the csv columns are the
+attributes of the first page.
+
+With --resume <file>, a checkpoint (the LastEvaluatedKey, the current --pk, and
+the size of the output) is written to <file> every few seconds, and on Ctrl-C (or
+--timeout, or an error). Running the same command again continues from it, after
+truncating the output to the checkpointed size. The file is removed once the
+export completes.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               exportQueryCmd,
+	}
+)
+
+// exportCheckpoint is the --resume file of 'lsdy export'.
+type exportCheckpoint struct {
+	Sig     string                              `json:"sig"`
+	PK      int                                 `json:"pk"` // index of the current --pk/--sk pair, see pairKeys
+	LastKey map[string]*dynamodb.AttributeValue `json:"lastKey"`
+	Cols    []string                            `json:"cols,omitempty"` // csv columns
+	Offset  int64                               `json:"offset"`         // output size
+	Rows    int                                 `json:"rows"`
+	Fetched int                                 `json:"fetched"`
+	Pages   int                                 `json:"pages"`
+	Time    time.Time                           `json:"time"`
+}
+
+// exporter writes the rows of each page, see exportCmd.
+type exporter struct {
+	w       io.Writer
+	cw      *csv.Writer // nil for json lines
+	p       *lsdy.Pipeline
+	sc      *script // --script, if set
+	execs   []*execSpec
+	val     *validator // --validate, if set
+	rows    int
+	pages   int
+	invalid int
+}
+
+// page runs the row pipeline against items, and writes the resulting rows.
+func (e *exporter) page(items []map[string]*dynamodb.AttributeValue) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	m, err := lsdy.UnmarshalItems(items)
+	if err != nil {
+		return err
+	}
+
+	if e.val != nil {
+		n, err := e.val.check(m)
+		if err != nil {
+			return err
+		}
+
+		e.invalid += n
+	}
+
+	m, err = prepareItems(e.p, e.sc, e.execs, m)
+	if err != nil {
+		return err
+	}
+
+	cols := e.p.Columns(m)
+	e.pages++
+	if e.cw != nil {
+		if len(e.p.Attrs) == 0 {
+			e.p.Attrs = cols // the next pages have the same columns
+		}
+
+		hdrs, err := csvHeaders(e.p, cols, e.p.Headers(cols))
+		if err != nil {
+			return err
+		}
+
+		if e.pages == 1 {
+			if err := e.cw.Write(hdrs); err != nil {
+				return err
+			}
+		}
+	}
+
+	out := e.p.Rows(m, cols)
+	for i, r := range out {
+		if e.cw != nil {
+			cells := r.CSV
+			if rownum {
+				cells = append([]string{strconv.Itoa(e.rows + i + 1)}, cells...) // across the pages
+			}
+
+			if err := e.cw.Write(cells); err != nil {
+				return err
+			}
+		} else {
+			line, err := lsdy.JSON(e.p.Full(r))
+			if err != nil {
+				return err
+			}
+
+			if _, err := io.WriteString(e.w, line+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	e.rows += len(out)
+	if e.cw != nil {
+		e.cw.Flush()
+		return e.cw.Error()
+	}
+
+	return nil
+}
+
+func exportQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := cmdFlags(cmd)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 1 {
+		return usageErrorf("expecting <table>")
+	}
+
+	switch {
+	case exout == "":
+		return usageErrorf("--out cannot be empty")
+	case del:
+		return usageErrorf("--delete is not supported with export")
+	case watch > 0:
+		return usageErrorf("--watch is not supported with export")
+	case len(sortby) > 0, top != "", bottom != "", fs.Changed("dedupe"):
+		return usageErrorf("--sort-by, --top, --bottom, and --dedupe are not supported with export")
+	}
+
+	if exfmt == "" {
+		exfmt = "ndjson"
+		if filepath.Ext(exout) == ".csv" {
+			exfmt = "csv"
+		}
+	}
+
+	if exfmt != "csv" && exfmt != "ndjson" {
+		return usageErrorf("invalid --format value: %v", exfmt)
+	}
+
+	if exres != "" && exout == "-" {
+		return usageErrorf("--resume needs --out to be a file")
+	}
+
+	if exres != "" && (limit > 0 || keylimit > 0) {
+		return usageErrorf("--limit and --limit-per-key are not supported with --resume")
+	}
+
+	log.SetFlags(0)
+	var prefix string
+	if cfgfile != "" {
+		var err error
+		prefix, err = loadConfig(rootCmd.Flags(), cfgfile, fs.Changed("config") || envname != "")
+		if err != nil {
+			return err
+		}
+	}
+
+	filter, err := filterCond(filters)
+	if err != nil {
+		return err
+	}
+
+	// The pipeline (and --script, etc.) is set up once, for all the pages.
+	widths, err := parseMaxlen(maxlen, tablewriter.MAX_ROW_WIDTH)
+	if err != nil {
+		return err
+	}
+
+	p, err := newPipeline(cmd, widths)
+	if err != nil {
+		return err
+	}
+
+	e := &exporter{p: p}
+	e.execs, err = parseExecs(execs)
+	if err != nil {
+		return err
+	}
+
+	if scriptf != "" {
+		e.sc, err = newScript(scriptf)
+		if err != nil {
+			return err
+		}
+	}
+
+	table := fs.Arg(0)
+	svc, err := newService()
+	if err != nil {
+		return err
+	}
+
+	t, err := describeTable(svc, prefix+table)
+	if err != nil {
+		return err
+	}
+
+	// Only the items expiring within the window are exported.
+	if expiring != "" {
+		window, err := parseWindow(expiring)
+		if err != nil {
+			return err
+		}
+
+		ttlattr, err := ttlAttr(svc, prefix+table)
+		if err != nil {
+			return err
+		}
+
+		c := expiringCond(ttlattr, time.Now().Add(window))
+		if filter != nil {
+			c = expression.And(*filter, c)
+		}
+
+		filter = &c
+	}
+
+	// The key columns, for --keys-only, and the '@keys' of --column-order.
+	keys := tableKeys(t)
+	pklbl, sklbl := keys[0], ""
+	if len(keys) > 1 {
+		sklbl = keys[1]
+	}
+
+	p.Pin = pinned(pklbl, sklbl)
+	if keysonly {
+		p.Attrs = keys
+	}
+
+	if validate != "" {
+		e.val, err = newValidator(validate, pklbl, sklbl)
+		if err != nil {
+			return err
+		}
+	}
+
+	var cp exportCheckpoint
+	sig := fmt.Sprint(prefix+table, pk, sk, skbetw, index, filters, incols, exfmt)
+	resumed := false
+	if exres != "" {
+		err := readJSON(exres, &cp)
+		switch {
+		case err == nil && cp.Sig != sig:
+			return fmt.Errorf("%v is the checkpoint of a different export", exres)
+		case err == nil:
+			resumed = true
+		case !os.IsNotExist(err):
+			return err
+		}
+	}
+
+	w := os.Stdout
+	switch {
+	case resumed:
+		w, err = os.OpenFile(exout, os.O_WRONLY, 0)
+		if err == nil {
+			// Drop what was written after the checkpoint.
+			if err = w.Truncate(cp.Offset); err == nil {
+				_, err = w.Seek(cp.Offset, io.SeekStart)
+			}
+		}
+	case exout != "-":
+		w, err = os.Create(exout)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if w != os.Stdout {
+		defer w.Close()
+	}
+
+	e.w, e.rows, e.pages = w, cp.Rows, cp.Pages
+	if exfmt == "csv" {
+		e.cw = csv.NewWriter(w)
+		e.cw.UseCRLF = csvstrct
+		if len(p.Attrs) == 0 {
+			p.Attrs = cp.Cols
+		}
+	}
+
+	if resumed {
+		log.Printf("resuming from %v: %v rows exported (%v)\n", exres, cp.Rows, cp.Time.Local().Format(time.RFC3339))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	withContext(ctx, svc)
+	xferrs := transformErrors(p)
+	defer xferrs()
+
+	// cp is updated after each page, and saved every few seconds.
+	cp.Sig = sig
+	save := func() error {
+		if exres == "" {
+			return nil
+		}
+
+		cp.Cols, cp.Time = p.Attrs, time.Now().UTC()
+		return writeJSON(exres, cp)
+	}
+
+	start, fetched := time.Now(), cp.Fetched
+	logged, saved := start, start
+	cur := cp.PK - 1 // incremented by Begin
+	each := func(items []map[string]*dynamodb.AttributeValue, lastKey map[string]*dynamodb.AttributeValue) error {
+		fetched += len(items)
+		if err := e.page(items); err != nil {
+			return err
+		}
+
+		cp.PK, cp.LastKey = max(cur, 0), lastKey
+		if lastKey == nil {
+			cp.PK++ // done with this --pk
+		}
+
+		cp.Rows, cp.Fetched, cp.Pages = e.rows, fetched, e.pages
+		if exres != "" {
+			off, err := w.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+
+			cp.Offset = off
+		}
+
+		if time.Since(saved) >= 5*time.Second {
+			saved = time.Now()
+			if err := save(); err != nil {
+				return err
+			}
+		}
+
+		if time.Since(logged) >= 10*time.Second {
+			logged = time.Now()
+			log.Printf("exported %v rows (%v items fetched) so far\n", e.rows, fetched)
+		}
+
+		return nil
+	}
+
+	if len(pk) > 0 {
+		pks, sks := pairKeys(pk, sk)
+		q := &lsdy.Query{
+			Table:    prefix + table,
+			Index:    index,
+			PK:       pks[cp.PK:],
+			Limit:    keylimit,
+			Total:    limit,
+			PageSize: pagesize,
+			Types:    lsdy.KeyTypes(t.Table),
+			Filter:   filter,
+			Start:    cp.LastKey,
+			Begin:    func(string) { cur++ },
+			Page:     each,
+		}
+
+		q.SK, q.Between = sks[cp.PK:], skbetw
+
+		_, err = q.Run(svc)
+	} else {
+		scan := &lsdy.Scan{
+			Table:    prefix + table,
+			Index:    index,
+			Limit:    limit,
+			PageSize: pagesize,
+			Filter:   filter,
+			Start:    cp.LastKey,
+			Page:     each,
+		}
+
+		_, err = scan.Run(svc)
+	}
+
+	if err != nil {
+		if exres != "" {
+			if err := save(); err != nil {
+				log.Printf("checkpoint %v: %v\n", exres, err)
+			} else {
+				log.Printf("%v rows exported, run the same command to resume from %v\n", e.rows, exres)
+			}
+		}
+
+		if ctx.Err() != nil {
+			return &codeError{exitInterrupted, fmt.Errorf("interrupted: %v", ctx.Err())}
+		}
+
+		return err
+	}
+
+	if exres != "" {
+		os.Remove(exres)
+	}
+
+	log.Printf("exported %v rows (%v items fetched, %v pages) to %v in %v\n", e.rows, fetched, e.pages,
+		exout, time.Since(start).Round(time.Second))
+	if e.invalid > 0 {
+		return &codeError{exitInvalid, fmt.Errorf("%v of %v items failed --validate", e.invalid, fetched)}
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+)
+
+// fetchSpec is the query (or scan) of a run, as set by its flags.
+type fetchSpec struct {
+	table  string // with the table_prefix
+	t      *dynamodb.DescribeTableOutput
+	cached *cacheEntry // if fresh enough, or with --offline
+	index  string      // queried, the one keyed by --pk (and --sk) if not set
+	filter *expression.ConditionBuilder
+	proj   []string // the attributes of --keys-only
+	limit  int64    // with the --skip rows
+	key    string   // of the items kept by the shell
+	pages  *pageLog
+}
+
+// items returns the items of the shell (for the same query), or of the cache,
+// or fetched from aws: by TransactGetItems (--transact), Query (--pk), or Scan.
+// The fresh ones are cached, and saved as --snapshot. If ctx is done, the items
+// fetched so far are returned.
+func (f *fetchSpec) items(ctx context.Context, svc *dynamodb.DynamoDB) ([]map[string]*dynamodb.AttributeValue, error) {
+	var items []map[string]*dynamodb.AttributeValue
+	var err error
+	live := false // fetched from aws
+	switch {
+	case shcache != nil && shcache.feed != nil:
+		items = shcache.feed
+	case f.cached != nil:
+		if !quiet {
+			log.Printf("using the items cached at %v\n", f.cached.Time.Local().Format(time.RFC3339))
+		}
+
+		items = f.cached.Items
+	case shcache != nil && shcache.itemsKey == f.key:
+		items = shcache.items
+	case len(pk) > 0 && transact:
+		live = true
+		pks, sks := pairKeys(pk, sk)
+		var keys []map[string]*dynamodb.AttributeValue
+		for i := range pks {
+			vals := []string{pks[i]}
+			if sks[i] != "" {
+				vals = append(vals, sks[i])
+			}
+
+			k, err := tableKey(f.t.Table, vals...)
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, k)
+		}
+
+		if explain {
+			log.Printf("explain: TransactGetItems of %v keys on table %v\n", len(keys), f.table)
+		}
+
+		got, err := lsdy.TransactGet(svc, f.table, keys, f.proj)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, v := range got {
+			if v == nil {
+				if !quiet {
+					log.Printf("not found: %v\n", strings.TrimSuffix(pks[i]+", "+sks[i], ", "))
+				}
+
+				continue
+			}
+
+			items = append(items, v)
+		}
+	case len(pk) > 0:
+		live = true
+		var cur string
+		pks, sks := pairKeys(pk, sk)
+		q := &lsdy.Query{
+			Table:      f.table,
+			Index:      f.index,
+			PK:         pks,
+			SK:         sks,
+			Between:    skbetw,
+			Limit:      keylimit,
+			Total:      f.limit,
+			PageSize:   pagesize,
+			Types:      lsdy.KeyTypes(f.t.Table),
+			Filter:     f.filter,
+			Projection: f.proj,
+			Begin: func(v string) {
+				cur = v
+				f.pages.begin()
+			},
+		}
+
+		if explain {
+			if err := explainQuery(os.Stderr, q); err != nil {
+				return nil, err
+			}
+		}
+
+		items, err = q.Run(svc)
+		if err != nil {
+			if ctx.Err() == nil {
+				return nil, err
+			}
+
+			log.Printf("interrupted while querying --pk %v\n", cur)
+		}
+	default:
+		live = true
+		scan := &lsdy.Scan{
+			Table:      f.table,
+			Index:      index,
+			Limit:      f.limit,
+			PageSize:   pagesize,
+			Filter:     f.filter,
+			Projection: f.proj,
+		}
+
+		if e, ok := lsdy.EstimateScan(f.t.Table, scan); ok {
+			msg := fmt.Sprintf("scan of ~%v items (~%.1f MB): ~%v pages, ~%v RCUs", e.Items, float64(e.Bytes)/(1<<20), e.Pages, e.RCU)
+			switch {
+			case scanmax > 0 && e.RCU >= scanmax && !force:
+				// The filters are applied after the items are read, and the RCUs are
+				// consumed either way.
+				return nil, &codeError{exitScanMax, fmt.Errorf("%v, over --scan-max-rcu; narrow it with --pk/--limit (--filter and --contains don't reduce it), or use --force", msg)}
+			case e.RCU >= scanwarn:
+				log.Printf("warning: %v\n", msg)
+			case explain:
+				log.Printf("explain: %v\n", msg)
+			}
+		}
+
+		if explain {
+			if err := explainScan(os.Stderr, scan); err != nil {
+				return nil, err
+			}
+		}
+
+		items, err = scan.Run(svc)
+		if err != nil && ctx.Err() == nil {
+			return nil, err
+		}
+	}
+
+	// Display what we have so far if interrupted.
+	if ctx.Err() != nil {
+		items = f.pages.fetched()
+		log.Printf("%v: showing the %v items fetched so far\n", ctx.Err(), len(items))
+		if c := f.pages.cursor(); c != "" {
+			log.Printf("resume cursor (LastEvaluatedKey): %v\n", c)
+		}
+
+		return items, nil
+	}
+
+	if shcache != nil {
+		shcache.itemsKey, shcache.items = f.key, items
+	}
+
+	entry := &cacheEntry{Time: time.Now(), Query: querySig(f.table), Table: f.t, Items: items}
+	if cachettl > 0 && live {
+		if err := writeJSON(cacheFile(entry.Query), entry); err != nil {
+			log.Printf("cache: %v\n", err)
+		}
+	}
+
+	if snaptag != "" {
+		if err := writeJSON(snapshotPath(snaptag), entry); err != nil {
+			return nil, err
+		}
+
+		if !quiet {
+			log.Printf("snapshot %v: %v items\n", snaptag, len(items))
+		}
+	}
+
+	return items, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// filterOps are the --filter operators, two-character ones first.
+var filterOps = []string{"!=", "<=", ">=", "^=", "~=", "=", "<", ">"}
+
+// parseFilter parses a --filter value, fmt: <attr><op><value>, where op is one of
+// =, !=, <, <=, >, >=, ^= (begins with), or ~= (contains), i.e. 'status!=done',
+// 'retries>=3', 'meta.region^=ap-'. Values that look like numbers (or booleans)
+// are compared as such, unless quoted, i.e. 'code="42"'.
+func parseFilter(v string) (expression.ConditionBuilder, error) {
+	i := strings.IndexAny(v, "!<>^~=")
+	if i <= 0 {
+		return expression.ConditionBuilder{}, usageErrorf("invalid --filter format: %v", v)
+	}
+
+	var op string
+	for _, o := range filterOps {
+		if strings.HasPrefix(v[i:], o) {
+			op = o
+			break
+		}
+	}
+
+	if op == "" {
+		return expression.ConditionBuilder{}, usageErrorf("invalid --filter format: %v", v)
+	}
+
+	name := expression.Name(v[:i])
+	raw := v[i+len(op):]
+	val := expression.Value(filterValue(raw))
+	switch op {
+	case "=":
+		return name.Equal(val), nil
+	case "!=":
+		return name.NotEqual(val), nil
+	case "<":
+		return name.LessThan(val), nil
+	case "<=":
+		return name.LessThanEqual(val), nil
+	case ">":
+		return name.GreaterThan(val), nil
+	case ">=":
+		return name.GreaterThanEqual(val), nil
+	case "^=":
+		return name.BeginsWith(strings.Trim(raw, `"`)), nil
+	default:
+		return name.Contains(strings.Trim(raw, `"`)), nil
+	}
+}
+
+// filterValue returns the attribute value of a --filter value.
+func filterValue(v string) *dynamodb.AttributeValue {
+	if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+		return &dynamodb.AttributeValue{S: aws.String(v[1 : len(v)-1])}
+	}
+
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return &dynamodb.AttributeValue{N: aws.String(v)}
+	}
+
+	if b, err := strconv.ParseBool(v); err == nil && (v == "true" || v == "false") {
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(b)}
+	}
+
+	return &dynamodb.AttributeValue{S: aws.String(v)}
+}
+
+// filterCond returns the --filter values as one condition (all of them), or nil.
+func filterCond(vals []string) (*expression.ConditionBuilder, error) {
+	var conds []expression.ConditionBuilder
+	for _, v := range vals {
+		c, err := parseFilter(v)
+		if err != nil {
+			return nil, err
+		}
+
+		conds = append(conds, c)
+	}
+
+	switch len(conds) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &conds[0], nil
+	default:
+		c := expression.And(conds[0], conds[1], conds[2:]...)
+		return &c, nil
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// histEntry is a single line in the history file.
+type histEntry struct {
+	Time  time.Time              `json:"time"`
+	Table string                 `json:"table"`
+	Flags map[string]interface{} `json:"flags,omitempty"`
+	Rows  int                    `json:"rows"`
+}
+
+var (
+	histlast int
+
+	historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "list the previous invocations, see 'lsdy rerun'",
+		Args:  cobra.NoArgs,
+		RunE:  historyQueryCmd,
+	}
+
+	rerunCmd = &cobra.Command{
+		Use:                "rerun <n> [flags]",
+		Short:              "run the n'th invocation in 'lsdy history' again, flags in the command line take precedence",
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               rerunQueryCmd,
+	}
+)
+
+// stateDir returns the location of the files lsdy keeps between runs,
+// $XDG_STATE_HOME/lsdy, or ~/.local/state/lsdy.
+func stateDir() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+
+		dir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(dir, "lsdy")
+}
+
+// historyPath returns the history file location, see stateDir.
+func historyPath() string {
+	dir := stateDir()
+	if dir == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, "history")
+}
+
+// addHistory appends an entry to the history file. Errors are not fatal since
+// the history is only a convenience.
+func addHistory(table string, flags map[string]interface{}, rows int) {
+	file := historyPath()
+	if file == "" {
+		return
+	}
+
+	b, err := json.Marshal(histEntry{
+		Time:  time.Now().UTC(),
+		Table: table,
+		Flags: flags,
+		Rows:  rows,
+	})
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		debugf(1, "history: %v", err)
+		return
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		debugf(1, "history: %v", err)
+		return
+	}
+
+	defer f.Close()
+	f.Write(append(b, '\n'))
+}
+
+// readHistory returns all the entries in the history file, oldest first.
+func readHistory() ([]histEntry, error) {
+	f, err := os.Open(historyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer f.Close()
+	var out []histEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e histEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // skip garbled lines
+		}
+
+		out = append(out, e)
+	}
+
+	return out, scanner.Err()
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:=,@%+-]+$`)
+
+// shellQuote quotes v for display in a shell command line, if needed.
+func shellQuote(v string) string {
+	if shellSafe.MatchString(v) {
+		return v
+	}
+
+	return "'" + strings.Replace(v, "'", `'\''`, -1) + "'"
+}
+
+// cmdline returns the entry as a shell command line.
+func (e histEntry) cmdline() string {
+	out := []string{"lsdy", shellQuote(e.Table)}
+	var names []string
+	for k := range e.Flags {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	for _, k := range names {
+		switch v := e.Flags[k].(type) {
+		case bool:
+			if v {
+				out = append(out, "--"+k)
+			} else {
+				out = append(out, "--"+k+"=false")
+			}
+		case []interface{}:
+			for _, val := range v {
+				out = append(out, "--"+k, shellQuote(fmt.Sprintf("%v", val)))
+			}
+		default:
+			out = append(out, "--"+k, shellQuote(fmt.Sprintf("%v", v)))
+		}
+	}
+
+	return strings.Join(out, " ")
+}
+
+func historyQueryCmd(cmd *cobra.Command, args []string) error {
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+
+	start := 0
+	if histlast > 0 && len(entries) > histlast {
+		start = len(entries) - histlast
+	}
+
+	for i := start; i < len(entries); i++ {
+		e := entries[i]
+		fmt.Printf("%5d  %v  %6d rows  %v\n", i+1, e.Time.Local().Format("2006-01-02 15:04:05"), e.Rows, e.cmdline())
+	}
+
+	return nil
+}
+
+func rerunQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := rootCmd.Flags()
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 1 {
+		return usageErrorf("expecting <n>")
+	}
+
+	n, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid history number: %v", fs.Arg(0))
+	}
+
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+
+	if n < 1 || n > len(entries) {
+		return fmt.Errorf("history number out of range [1-%v]: %v", len(entries), n)
+	}
+
+	e := entries[n-1]
+	if err := setFlags(fs, e.Flags, "history "+fs.Arg(0)); err != nil {
+		return err
+	}
+
+	return run(rootCmd, []string{e.Table})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hksample int64
+	hksince  time.Duration
+	hkkeys   int
+
+	hotkeysCmd = &cobra.Command{
+		Use:   "hotkeys <table> [flags]",
+		Short: "rank the partition keys most likely responsible for throttling",
+		Long: `Combine the throttle events, and consumed capacity of the table (or of --index)
+in CloudWatch over the last --since, with the distribution of the items (count,
+and size) over the partition keys in the first --sample items of a scan, into a
+report of the partition keys most likely responsible for throttling.
+
+Throttling while the table is below its capacity (or on-demand) means that some
+partitions get more than their share (a partition serves up to 3000 RCU, and 1000
+WCU per second): the partition keys with the largest share of the data are the
+likely ones, since they are the most expensive to read (and to write, if written
+in proportion). The distribution is only a proxy for the traffic; for the keys
+actually accessed and throttled, see 'lsdy insights'.
+
+The scan is in hash order, so the sample is spread over the partition keys.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               hotkeysQueryCmd,
+	}
+)
+
+// avSize returns the approximate stored size of v, in bytes.
+func avSize(v *dynamodb.AttributeValue) int64 {
+	switch {
+	case v.S != nil:
+		return int64(len(*v.S))
+	case v.N != nil:
+		return int64(len(*v.N)+1)/2 + 1
+	case v.B != nil:
+		return int64(len(v.B))
+	case v.SS != nil:
+		var n int64
+		for _, s := range v.SS {
+			n += int64(len(*s))
+		}
+
+		return n
+	case v.NS != nil:
+		var n int64
+		for _, s := range v.NS {
+			n += int64(len(*s)+1)/2 + 1
+		}
+
+		return n
+	case v.BS != nil:
+		var n int64
+		for _, b := range v.BS {
+			n += int64(len(b))
+		}
+
+		return n
+	case v.M != nil:
+		return 3 + itemSize(v.M)
+	case v.L != nil:
+		n := int64(3)
+		for _, e := range v.L {
+			n += 1 + avSize(e)
+		}
+
+		return n
+	}
+
+	return 1 // BOOL, NULL
+}
+
+// itemSize returns the approximate stored size of item, in bytes.
+func itemSize(item map[string]*dynamodb.AttributeValue) int64 {
+	var n int64
+	for k, v := range item {
+		n += int64(len(k)) + avSize(v)
+	}
+
+	return n
+}
+
+// keyDist is the share of the data of a partition key.
+type keyDist struct {
+	key   string
+	items int64
+	bytes int64
+}
+
+// metricSeries returns the per-period sums of a table (or index) metric, by time.
+func metricSeries(cw *cloudwatch.CloudWatch, table, index, metric string, since time.Duration, period int64) (map[time.Time]float64, error) {
+	dims := []*cloudwatch.Dimension{{Name: aws.String("TableName"), Value: aws.String(table)}}
+	if index != "" {
+		dims = append(dims, &cloudwatch.Dimension{Name: aws.String("GlobalSecondaryIndexName"), Value: aws.String(index)})
+	}
+
+	now := time.Now()
+	out, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/DynamoDB"),
+		MetricName: aws.String(metric),
+		Dimensions: dims,
+		StartTime:  aws.Time(now.Add(-since)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(period),
+		Statistics: []*string{aws.String(cloudwatch.StatisticSum)},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[time.Time]float64)
+	for _, d := range out.Datapoints {
+		m[aws.TimeValue(d.Timestamp)] = aws.Float64Value(d.Sum)
+	}
+
+	return m, nil
+}
+
+// seriesPeak returns the largest value of a series, and its time.
+func seriesPeak(m map[time.Time]float64) (float64, time.Time) {
+	var max float64
+	var at time.Time
+	for k, v := range m {
+		if v > max {
+			max, at = v, k
+		}
+	}
+
+	return max, at
+}
+
+// seriesSum returns the sum of a series.
+func seriesSum(m map[time.Time]float64) float64 {
+	var n float64
+	for _, v := range m {
+		n += v
+	}
+
+	return n
+}
+
+func hotkeysQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	log.SetFlags(0)
+	switch {
+	case hksample < 0:
+		return usageErrorf("invalid --sample value: %v", hksample)
+	case hksince <= 0:
+		return usageErrorf("invalid --since value: %v", hksince)
+	case hkkeys < 1:
+		return usageErrorf("invalid --keys value: %v", hkkeys)
+	}
+
+	table := aws.StringValue(t.TableName)
+	hash, _ := keyNames(t.KeySchema)
+	var idx *string
+	var rcu, wcu *int64
+	if p := t.ProvisionedThroughput; p != nil {
+		rcu, wcu = p.ReadCapacityUnits, p.WriteCapacityUnits
+	}
+
+	if index != "" {
+		var gsi *dynamodb.GlobalSecondaryIndexDescription
+		for _, v := range t.GlobalSecondaryIndexes {
+			if aws.StringValue(v.IndexName) == index {
+				gsi = v
+			}
+		}
+
+		if gsi == nil {
+			return &codeError{exitNotFound, fmt.Errorf("%v: no global secondary index %v", table, index)}
+		}
+
+		idx = gsi.IndexName
+		hash, _ = keyNames(gsi.KeySchema)
+		if p := gsi.ProvisionedThroughput; p != nil {
+			rcu, wcu = p.ReadCapacityUnits, p.WriteCapacityUnits
+		}
+	}
+
+	ondemand := t.BillingModeSummary != nil && aws.StringValue(t.BillingModeSummary.BillingMode) == dynamodb.BillingModePayPerRequest
+
+	// The throttles, and consumed capacity, per minute (or hour, beyond a day).
+	sess, cnfs, err := newSession()
+	if err != nil {
+		return err
+	}
+
+	period := int64(60)
+	if hksince > 24*time.Hour {
+		period = 3600
+	}
+
+	cw := cloudwatch.New(sess, cnfs...)
+	series := make(map[string]map[time.Time]float64)
+	for _, m := range []string{"ReadThrottleEvents", "WriteThrottleEvents", "ConsumedReadCapacityUnits", "ConsumedWriteCapacityUnits"} {
+		series[m], err = metricSeries(cw, table, index, m, hksince, period)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The distribution of the sampled items over the partition keys.
+	dist := make(map[string]*keyDist)
+	var items, bytes int64
+	_, err = (&lsdy.Scan{
+		Table: table,
+		Index: index,
+		Limit: hksample,
+		Page: func(page []map[string]*dynamodb.AttributeValue, _ map[string]*dynamodb.AttributeValue) error {
+			for _, item := range page {
+				var k string
+				for _, v := range avJSON(item[hash]) {
+					k = fmt.Sprint(v)
+				}
+
+				if dist[k] == nil {
+					dist[k] = &keyDist{key: k}
+				}
+
+				n := itemSize(item)
+				dist[k].items++
+				dist[k].bytes += n
+				items++
+				bytes += n
+			}
+
+			return nil
+		},
+	}).Run(svc)
+
+	if err != nil {
+		return err
+	}
+
+	name := table
+	if index != "" {
+		name += " (" + index + ")"
+	}
+
+	rt, wt := seriesSum(series["ReadThrottleEvents"]), seriesSum(series["WriteThrottleEvents"])
+	fmt.Printf("%v, last %v:\n", name, hksince)
+	for _, v := range []struct {
+		label       string
+		throttles   string
+		consumed    string
+		provisioned *int64
+	}{
+		{"read", "ReadThrottleEvents", "ConsumedReadCapacityUnits", rcu},
+		{"write", "WriteThrottleEvents", "ConsumedWriteCapacityUnits", wcu},
+	} {
+		tmax, tat := seriesPeak(series[v.throttles])
+		cmax, _ := seriesPeak(series[v.consumed])
+		capacity := "on-demand"
+		if !ondemand {
+			capacity = fmt.Sprintf("provisioned %v/s", aws.Int64Value(v.provisioned))
+		}
+
+		fmt.Printf("  %-5v  %6.0f throttle events", v.label, seriesSum(series[v.throttles]))
+		if tmax > 0 {
+			fmt.Printf(" (peak %.0f at %v)", tmax, tat.Local().Format("15:04"))
+		}
+
+		fmt.Printf(", consumed peak %.1f/s (%v)\n", cmax/float64(period), capacity)
+	}
+
+	// At capacity is a peak within 80% of the provisioned throughput.
+	atcap := func(consumed string, provisioned *int64) bool {
+		p, _ := seriesPeak(series[consumed])
+		return !ondemand && aws.Int64Value(provisioned) > 0 && p/float64(period) >= 0.8*float64(aws.Int64Value(provisioned))
+	}
+
+	fmt.Println()
+	switch {
+	case rt == 0 && wt == 0:
+		fmt.Println("No throttling; the partition keys below are where a hot partition would come from.")
+	case (rt == 0 || atcap("ConsumedReadCapacityUnits", rcu)) && (wt == 0 || atcap("ConsumedWriteCapacityUnits", wcu)):
+		fmt.Println("Throttled at (or near) the provisioned capacity: likely the overall load rather than hot keys.")
+	default:
+		fmt.Println("Throttled below the capacity of the table: likely hot partitions, see the partition keys below.")
+	}
+
+	ranked := make([]*keyDist, 0, len(dist))
+	for _, v := range dist {
+		ranked = append(ranked, v)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].bytes != ranked[j].bytes {
+			return ranked[i].bytes > ranked[j].bytes
+		}
+
+		return ranked[i].key < ranked[j].key
+	})
+
+	fmt.Printf("\n%v partition keys (%v) in %v sampled items (%.1f MB):\n", len(dist), hash, items, float64(bytes)/(1<<20))
+	fmt.Printf("%5v  %10v  %7v  %10v  %7v  %v\n", "rank", "items", "share", "KB", "share", "key")
+	for i, v := range ranked {
+		if i == hkkeys {
+			break
+		}
+
+		fmt.Printf("%5d  %10d  %6.1f%%  %10.1f  %6.1f%%  %v\n", i+1, v.items, 100*float64(v.items)/float64(items), float64(v.bytes)/1024, 100*float64(v.bytes)/float64(bytes), v.key)
+	}
+
+	if ci, err := svc.DescribeContributorInsights(&dynamodb.DescribeContributorInsightsInput{
+		TableName: t.TableName,
+		IndexName: idx,
+	}); err == nil && aws.StringValue(ci.ContributorInsightsStatus) == dynamodb.ContributorInsightsStatusEnabled {
+		log.Println("contributor insights is enabled, see 'lsdy insights' for the keys actually throttled")
+	}
+
+	return nil
+}
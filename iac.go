@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	iacfmt string
+
+	iacCmd = &cobra.Command{
+		Use:   "iac <table> --format terraform|cfn [flags]",
+		Short: "print the terraform (or cloudformation) definition of an existing table",
+		Long: `Convert the description of an existing table (keys, indexes, capacity, stream,
+ttl, point-in-time recovery, encryption, table class, deletion protection, and
+tags) into an infrastructure-as-code resource definition, to bring a table made by
+hand under terraform (an aws_dynamodb_table resource, with an import block), or
+cloudformation (an AWS::DynamoDB::Table resource, with DeletionPolicy Retain, for
+a resource import). Settings that can't be read (i.e. no permission) are skipped
+with a warning. Autoscaling policies, replicas, and kinesis destinations are not
+included.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               iacQueryCmd,
+	}
+)
+
+// tableSettings is what DescribeTable doesn't include.
+type tableSettings struct {
+	ttl  string // attribute, if enabled
+	pitr bool
+	tags []*dynamodb.Tag
+}
+
+func readTableSettings(svc *dynamodb.DynamoDB, t *dynamodb.TableDescription) tableSettings {
+	var s tableSettings
+	ttl, err := svc.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{TableName: t.TableName})
+	switch {
+	case err != nil:
+		log.Printf("warning: ttl skipped: %v\n", err)
+	case aws.StringValue(ttl.TimeToLiveDescription.TimeToLiveStatus) == dynamodb.TimeToLiveStatusEnabled:
+		s.ttl = aws.StringValue(ttl.TimeToLiveDescription.AttributeName)
+	}
+
+	cb, err := svc.DescribeContinuousBackups(&dynamodb.DescribeContinuousBackupsInput{TableName: t.TableName})
+	if err != nil {
+		log.Printf("warning: point-in-time recovery skipped: %v\n", err)
+	} else if d := cb.ContinuousBackupsDescription.PointInTimeRecoveryDescription; d != nil {
+		s.pitr = aws.StringValue(d.PointInTimeRecoveryStatus) == dynamodb.PointInTimeRecoveryStatusEnabled
+	}
+
+	in := &dynamodb.ListTagsOfResourceInput{ResourceArn: t.TableArn}
+	for {
+		out, err := svc.ListTagsOfResource(in)
+		if err != nil {
+			log.Printf("warning: tags skipped: %v\n", err)
+			s.tags = nil
+			break
+		}
+
+		s.tags = append(s.tags, out.Tags...)
+		if out.NextToken == nil {
+			break
+		}
+
+		in.NextToken = out.NextToken
+	}
+
+	return s
+}
+
+// keyNames returns the hash, and range (if any) key attributes of a key schema.
+func keyNames(keys []*dynamodb.KeySchemaElement) (string, string) {
+	var hash, rng string
+	for _, k := range keys {
+		if aws.StringValue(k.KeyType) == dynamodb.KeyTypeHash {
+			hash = aws.StringValue(k.AttributeName)
+		} else {
+			rng = aws.StringValue(k.AttributeName)
+		}
+	}
+
+	return hash, rng
+}
+
+// payPerRequest reports whether t is on-demand.
+func payPerRequest(t *dynamodb.TableDescription) bool {
+	return t.BillingModeSummary != nil && aws.StringValue(t.BillingModeSummary.BillingMode) == dynamodb.BillingModePayPerRequest
+}
+
+var tfName = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// hcl writes terraform blocks, indented.
+type hcl struct {
+	strings.Builder
+	depth int
+}
+
+func (h *hcl) attr(name string, v interface{}) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = strconv.Quote(v)
+	case []string:
+		q := make([]string, len(v))
+		for i, e := range v {
+			q[i] = strconv.Quote(e)
+		}
+
+		s = "[" + strings.Join(q, ", ") + "]"
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	fmt.Fprintf(h, "%v%v = %v\n", strings.Repeat("  ", h.depth), name, s)
+}
+
+func (h *hcl) open(block string) {
+	fmt.Fprintf(h, "\n%v%v {\n", strings.Repeat("  ", h.depth), block)
+	h.depth++
+}
+
+func (h *hcl) close() {
+	h.depth--
+	fmt.Fprintf(h, "%v}\n", strings.Repeat("  ", h.depth))
+}
+
+// terraform returns the aws_dynamodb_table resource of t, and its import block.
+func terraform(t *dynamodb.TableDescription, s tableSettings) string {
+	name := aws.StringValue(t.TableName)
+	res := tfName.ReplaceAllString(name, "_")
+	if res == "" || (res[0] >= '0' && res[0] <= '9') || res[0] == '-' {
+		res = "t_" + res
+	}
+
+	h := &hcl{}
+	fmt.Fprintf(h, "import {\n  to = aws_dynamodb_table.%v\n  id = %q\n}\n", res, name)
+	h.open(fmt.Sprintf("resource \"aws_dynamodb_table\" %q", res))
+	h.attr("name", name)
+	hash, rng := keyNames(t.KeySchema)
+	h.attr("hash_key", hash)
+	if rng != "" {
+		h.attr("range_key", rng)
+	}
+
+	if payPerRequest(t) {
+		h.attr("billing_mode", dynamodb.BillingModePayPerRequest)
+	} else {
+		h.attr("billing_mode", dynamodb.BillingModeProvisioned)
+		h.attr("read_capacity", aws.Int64Value(t.ProvisionedThroughput.ReadCapacityUnits))
+		h.attr("write_capacity", aws.Int64Value(t.ProvisionedThroughput.WriteCapacityUnits))
+	}
+
+	if t.TableClassSummary != nil && t.TableClassSummary.TableClass != nil {
+		h.attr("table_class", aws.StringValue(t.TableClassSummary.TableClass))
+	}
+
+	if aws.BoolValue(t.DeletionProtectionEnabled) {
+		h.attr("deletion_protection_enabled", true)
+	}
+
+	if t.StreamSpecification != nil && aws.BoolValue(t.StreamSpecification.StreamEnabled) {
+		h.attr("stream_enabled", true)
+		h.attr("stream_view_type", aws.StringValue(t.StreamSpecification.StreamViewType))
+	}
+
+	for _, a := range t.AttributeDefinitions {
+		h.open("attribute")
+		h.attr("name", aws.StringValue(a.AttributeName))
+		h.attr("type", aws.StringValue(a.AttributeType))
+		h.close()
+	}
+
+	for _, g := range t.GlobalSecondaryIndexes {
+		h.open("global_secondary_index")
+		h.attr("name", aws.StringValue(g.IndexName))
+		hash, rng := keyNames(g.KeySchema)
+		h.attr("hash_key", hash)
+		if rng != "" {
+			h.attr("range_key", rng)
+		}
+
+		h.attr("projection_type", aws.StringValue(g.Projection.ProjectionType))
+		if len(g.Projection.NonKeyAttributes) > 0 {
+			h.attr("non_key_attributes", aws.StringValueSlice(g.Projection.NonKeyAttributes))
+		}
+
+		if !payPerRequest(t) && g.ProvisionedThroughput != nil {
+			h.attr("read_capacity", aws.Int64Value(g.ProvisionedThroughput.ReadCapacityUnits))
+			h.attr("write_capacity", aws.Int64Value(g.ProvisionedThroughput.WriteCapacityUnits))
+		}
+
+		h.close()
+	}
+
+	for _, l := range t.LocalSecondaryIndexes {
+		h.open("local_secondary_index")
+		h.attr("name", aws.StringValue(l.IndexName))
+		_, rng := keyNames(l.KeySchema)
+		h.attr("range_key", rng)
+		h.attr("projection_type", aws.StringValue(l.Projection.ProjectionType))
+		if len(l.Projection.NonKeyAttributes) > 0 {
+			h.attr("non_key_attributes", aws.StringValueSlice(l.Projection.NonKeyAttributes))
+		}
+
+		h.close()
+	}
+
+	if s.ttl != "" {
+		h.open("ttl")
+		h.attr("attribute_name", s.ttl)
+		h.attr("enabled", true)
+		h.close()
+	}
+
+	if s.pitr {
+		h.open("point_in_time_recovery")
+		h.attr("enabled", true)
+		h.close()
+	}
+
+	// No SSEDescription means encryption with an aws owned key (the default).
+	if d := t.SSEDescription; d != nil && aws.StringValue(d.Status) == dynamodb.SSEStatusEnabled {
+		h.open("server_side_encryption")
+		h.attr("enabled", true)
+		if d.KMSMasterKeyArn != nil {
+			h.attr("kms_key_arn", aws.StringValue(d.KMSMasterKeyArn))
+		}
+
+		h.close()
+	}
+
+	if len(s.tags) > 0 {
+		h.open("tags =")
+		for _, v := range s.tags {
+			h.attr(strconv.Quote(aws.StringValue(v.Key)), aws.StringValue(v.Value))
+		}
+
+		h.close()
+	}
+
+	h.close()
+	return h.String()
+}
+
+var cfnName = regexp.MustCompile(`[^a-zA-Z0-9]`) // logical ids are alphanumeric
+
+// cfnKeys returns the KeySchema of a cloudformation resource.
+func cfnKeys(keys []*dynamodb.KeySchemaElement) []map[string]string {
+	var out []map[string]string
+	for _, k := range keys {
+		out = append(out, map[string]string{"AttributeName": aws.StringValue(k.AttributeName), "KeyType": aws.StringValue(k.KeyType)})
+	}
+
+	return out
+}
+
+// cfnProjection returns the Projection of a cloudformation resource.
+func cfnProjection(p *dynamodb.Projection) map[string]interface{} {
+	out := map[string]interface{}{"ProjectionType": aws.StringValue(p.ProjectionType)}
+	if len(p.NonKeyAttributes) > 0 {
+		out["NonKeyAttributes"] = aws.StringValueSlice(p.NonKeyAttributes)
+	}
+
+	return out
+}
+
+// cfnThroughput returns the ProvisionedThroughput of a cloudformation resource.
+func cfnThroughput(p *dynamodb.ProvisionedThroughputDescription) map[string]int64 {
+	return map[string]int64{
+		"ReadCapacityUnits":  aws.Int64Value(p.ReadCapacityUnits),
+		"WriteCapacityUnits": aws.Int64Value(p.WriteCapacityUnits),
+	}
+}
+
+// cloudformation returns the template (json) of t, as an AWS::DynamoDB::Table.
+func cloudformation(t *dynamodb.TableDescription, s tableSettings) (string, error) {
+	props := map[string]interface{}{
+		"TableName": aws.StringValue(t.TableName),
+		"KeySchema": cfnKeys(t.KeySchema),
+	}
+
+	var attrs []map[string]string
+	for _, a := range t.AttributeDefinitions {
+		attrs = append(attrs, map[string]string{"AttributeName": aws.StringValue(a.AttributeName), "AttributeType": aws.StringValue(a.AttributeType)})
+	}
+
+	props["AttributeDefinitions"] = attrs
+	if payPerRequest(t) {
+		props["BillingMode"] = dynamodb.BillingModePayPerRequest
+	} else {
+		props["BillingMode"] = dynamodb.BillingModeProvisioned
+		props["ProvisionedThroughput"] = cfnThroughput(t.ProvisionedThroughput)
+	}
+
+	var gsis []map[string]interface{}
+	for _, g := range t.GlobalSecondaryIndexes {
+		v := map[string]interface{}{
+			"IndexName":  aws.StringValue(g.IndexName),
+			"KeySchema":  cfnKeys(g.KeySchema),
+			"Projection": cfnProjection(g.Projection),
+		}
+
+		if !payPerRequest(t) && g.ProvisionedThroughput != nil {
+			v["ProvisionedThroughput"] = cfnThroughput(g.ProvisionedThroughput)
+		}
+
+		gsis = append(gsis, v)
+	}
+
+	if len(gsis) > 0 {
+		props["GlobalSecondaryIndexes"] = gsis
+	}
+
+	var lsis []map[string]interface{}
+	for _, l := range t.LocalSecondaryIndexes {
+		lsis = append(lsis, map[string]interface{}{
+			"IndexName":  aws.StringValue(l.IndexName),
+			"KeySchema":  cfnKeys(l.KeySchema),
+			"Projection": cfnProjection(l.Projection),
+		})
+	}
+
+	if len(lsis) > 0 {
+		props["LocalSecondaryIndexes"] = lsis
+	}
+
+	if t.TableClassSummary != nil && t.TableClassSummary.TableClass != nil {
+		props["TableClass"] = aws.StringValue(t.TableClassSummary.TableClass)
+	}
+
+	if aws.BoolValue(t.DeletionProtectionEnabled) {
+		props["DeletionProtectionEnabled"] = true
+	}
+
+	if t.StreamSpecification != nil && aws.BoolValue(t.StreamSpecification.StreamEnabled) {
+		props["StreamSpecification"] = map[string]string{"StreamViewType": aws.StringValue(t.StreamSpecification.StreamViewType)}
+	}
+
+	if s.ttl != "" {
+		props["TimeToLiveSpecification"] = map[string]interface{}{"AttributeName": s.ttl, "Enabled": true}
+	}
+
+	if s.pitr {
+		props["PointInTimeRecoverySpecification"] = map[string]bool{"PointInTimeRecoveryEnabled": true}
+	}
+
+	if d := t.SSEDescription; d != nil && aws.StringValue(d.Status) == dynamodb.SSEStatusEnabled {
+		sse := map[string]interface{}{"SSEEnabled": true, "SSEType": aws.StringValue(d.SSEType)}
+		if d.KMSMasterKeyArn != nil {
+			sse["KMSMasterKeyId"] = aws.StringValue(d.KMSMasterKeyArn)
+		}
+
+		props["SSESpecification"] = sse
+	}
+
+	var tags []map[string]string
+	for _, v := range s.tags {
+		tags = append(tags, map[string]string{"Key": aws.StringValue(v.Key), "Value": aws.StringValue(v.Value)})
+	}
+
+	if len(tags) > 0 {
+		props["Tags"] = tags
+	}
+
+	id := cfnName.ReplaceAllString(aws.StringValue(t.TableName), "")
+	tmpl := map[string]interface{}{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Resources": map[string]interface{}{
+			id + "Table": map[string]interface{}{
+				"Type":           "AWS::DynamoDB::Table",
+				"DeletionPolicy": "Retain",
+				"Properties":     props,
+			},
+		},
+	}
+
+	b, err := json.MarshalIndent(tmpl, "", "  ")
+	return string(b), err
+}
+
+func iacQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if iacfmt != "terraform" && iacfmt != "cfn" {
+		return usageErrorf("invalid --format value: %v", iacfmt)
+	}
+
+	log.SetFlags(0)
+	s := readTableSettings(svc, t)
+	if iacfmt == "terraform" {
+		fmt.Print(terraform(t, s))
+		return nil
+	}
+
+	out, err := cloudformation(t, s)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(out)
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	impfrom   string
+	impupsert bool
+	impkeys   []string
+
+	importCmd = &cobra.Command{
+		Use:   "import <table> --from <file.csv> [flags]",
+		Short: "write the rows of a csv file into the table, one item each",
+		Long: `Write the rows of a csv file (with a header row of attribute names, '-' to read
+it from stdin) into the table, one item per row. The key attributes are taken
+from the --key-cols columns, the i'th being the table's i'th key (partition,
+then sort key), or from the columns named as the key attributes if not set.
+
+By default, each row replaces the whole item (PutItem). With --upsert, only the
+attributes of the other columns are set (UpdateItem), so that a csv with some of
+the columns doesn't remove the others. Empty cells are skipped either way.
+
+Values that look like numbers (or booleans) are stored as such, the others as
+strings; the key attributes have the types of the table's key.
+
+  lsdy import orders --from fix.csv --upsert --key-cols 'order_id,created'`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               importQueryCmd,
+	}
+)
+
+func importQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	log.SetFlags(0)
+	var r io.Reader = os.Stdin
+	switch impfrom {
+	case "":
+		return usageErrorf("--from cannot be empty")
+	case "-":
+	default:
+		f, err := os.Open(impfrom)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		r = f
+	}
+
+	cr := csv.NewReader(r)
+	hdrs, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("%v: no header row: %v", impfrom, err)
+	}
+
+	// The column of each key attribute.
+	types := lsdy.KeyTypes(t)
+	keycols := impkeys
+	if len(keycols) == 0 {
+		for _, k := range t.KeySchema {
+			keycols = append(keycols, aws.StringValue(k.AttributeName))
+		}
+	}
+
+	if len(keycols) != len(t.KeySchema) {
+		return usageErrorf("expecting %v --key-cols, the key of %v", len(t.KeySchema), aws.StringValue(t.TableName))
+	}
+
+	keyidx := make(map[int]string) // key=column, val=key attribute
+	for i, c := range keycols {
+		found := false
+		for j, h := range hdrs {
+			if h == c {
+				keyidx[j], found = aws.StringValue(t.KeySchema[i].AttributeName), true
+			}
+		}
+
+		if !found {
+			return usageErrorf("%v: no column %v for the key attribute %v", impfrom, c, aws.StringValue(t.KeySchema[i].AttributeName))
+		}
+	}
+
+	table := aws.StringValue(t.TableName)
+	var n, failed int
+	logged := time.Now()
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		key := make(map[string]*dynamodb.AttributeValue)
+		attrs := make(map[string]*dynamodb.AttributeValue)
+		for i, v := range row {
+			if name, ok := keyidx[i]; ok {
+				av, err := lsdy.KeyValue(types[name], v)
+				if err != nil {
+					return fmt.Errorf("line %v: %v", line, err)
+				}
+
+				key[name] = av
+				continue
+			}
+
+			if i < len(hdrs) && v != "" {
+				attrs[hdrs[i]] = filterValue(v)
+			}
+		}
+
+		if err := importRow(svc, table, key, attrs); err != nil {
+			failed++
+			log.Printf("line %v: %v\n", line, err)
+		} else {
+			n++
+		}
+
+		if time.Since(logged) >= 10*time.Second {
+			logged = time.Now()
+			log.Printf("imported %v rows so far\n", n)
+		}
+	}
+
+	if n+failed > 0 {
+		audit(table, "import", n, failed, changedFlags(cmdFlags(cmd), "config", "no-history"))
+	}
+
+	log.Printf("imported %v rows into %v\n", n, table)
+	if failed > 0 {
+		return fmt.Errorf("%v of %v rows failed", failed, n+failed)
+	}
+
+	return nil
+}
+
+// importRow writes a row, as a whole item, or only its attributes with --upsert.
+func importRow(svc *dynamodb.DynamoDB, table string, key, attrs map[string]*dynamodb.AttributeValue) error {
+	if !impupsert {
+		item := make(map[string]*dynamodb.AttributeValue)
+		for k, v := range attrs {
+			item[k] = v
+		}
+
+		for k, v := range key {
+			item[k] = v
+		}
+
+		_, err := svc.PutItem(&dynamodb.PutItemInput{TableName: aws.String(table), Item: item})
+		return err
+	}
+
+	in := &dynamodb.UpdateItemInput{TableName: aws.String(table), Key: key}
+	if len(attrs) > 0 {
+		var ub expression.UpdateBuilder
+		for _, k := range sortedAttrs(attrs) {
+			ub = ub.Set(expression.Name(k), expression.Value(attrs[k]))
+		}
+
+		expr, err := expression.NewBuilder().WithUpdate(ub).Build()
+		if err != nil {
+			return err
+		}
+
+		in.UpdateExpression = expr.Update()
+		in.ExpressionAttributeNames = expr.Names()
+		in.ExpressionAttributeValues = expr.Values()
+	}
+
+	_, err := svc.UpdateItem(in)
+	return err
+}
+
+// sortedAttrs returns the attribute names of item, sorted.
+func sortedAttrs(item map[string]*dynamodb.AttributeValue) []string {
+	var names []string
+	for k := range item {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	incby    float64
+	incexist bool
+
+	incCmd = &cobra.Command{
+		Use:   "inc <table> --pk <attr:value> [--sk <attr:value>] --attr <name> [flags]",
+		Short: "atomically add to the number attributes of an item, i.e. counters",
+		Long: `Atomically add --by (1 if not set, negative to subtract) to the --attr number
+attributes of the item with the --pk (and --sk) key, with an ADD update
+expression, and print their new values. A missing attribute starts from 0, and a
+missing item is created (with its key, and the counters only), unless --exists
+is set.
+
+  lsdy inc limits --pk tenant:acme --attr requests --by -100
+  lsdy inc seqs --pk name:invoice --attr next`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               incQueryCmd,
+	}
+)
+
+func incQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if len(incols) == 0 {
+		return usageErrorf("--attr cannot be empty")
+	}
+
+	key, err := keyFlags(t)
+	if err != nil {
+		return err
+	}
+
+	var ub expression.UpdateBuilder
+	for _, v := range incols {
+		ub = ub.Add(expression.Name(v), expression.Value(incby))
+	}
+
+	b := expression.NewBuilder().WithUpdate(ub)
+	if incexist {
+		hash, _ := keyNames(t.KeySchema)
+		b = b.WithCondition(expression.AttributeExists(expression.Name(hash)))
+	}
+
+	expr, err := b.Build()
+	if err != nil {
+		return usageError(err)
+	}
+
+	table := aws.StringValue(t.TableName)
+	out, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 t.TableName,
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return &codeError{exitNotFound, fmt.Errorf("%v: no item %v", table, strings.Join(append(pk[:1:1], sk...), ", "))}
+		}
+
+		return err
+	}
+
+	audit(table, "inc", 1, 0, changedFlags(cmdFlags(cmd), "config", "no-history"))
+	var m map[string]interface{}
+	if err := dynamodbattribute.UnmarshalMap(out.Attributes, &m); err != nil {
+		return err
+	}
+
+	for _, v := range incols {
+		if val, ok := lsdy.LookupPath(m, v); ok {
+			fmt.Printf("%v: %v\n", v, fmtval(val))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// keyIndex returns the index (empty for the table itself) to query by pkattr
+// (and skattr, if set), or false if there is none. The table comes first, then
+// its local secondary indexes, then its global ones, the ones that project all
+// the attributes first.
+func keyIndex(t *dynamodb.TableDescription, pkattr, skattr string) (string, bool) {
+	match := func(keys []*dynamodb.KeySchemaElement) bool {
+		h, r := keyNames(keys)
+		return h == pkattr && (skattr == "" || r == skattr)
+	}
+
+	if match(t.KeySchema) {
+		return "", true
+	}
+
+	if skattr != "" {
+		for _, v := range t.LocalSecondaryIndexes {
+			if match(v.KeySchema) {
+				return aws.StringValue(v.IndexName), true
+			}
+		}
+	}
+
+	var found string
+	for _, v := range t.GlobalSecondaryIndexes {
+		if !match(v.KeySchema) {
+			continue
+		}
+
+		if v.Projection != nil && aws.StringValue(v.Projection.ProjectionType) == dynamodb.ProjectionTypeAll {
+			return aws.StringValue(v.IndexName), true
+		}
+
+		if found == "" {
+			found = aws.StringValue(v.IndexName)
+		}
+	}
+
+	return found, found != ""
+}
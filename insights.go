@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cienable bool
+	cidisabl bool
+	cisince  time.Duration
+	cikeys   int64
+
+	insightsCmd = &cobra.Command{
+		Use:   "insights <table> [flags]",
+		Short: "print the most accessed (and throttled) keys of the table, from cloudwatch contributor insights",
+		Long: `Print the top keys of the table (or of --index) in each of its CloudWatch
+Contributor Insights rules, over the last --since: the most accessed, and most
+throttled partition keys, and the same for the full keys (partition, and sort), if
+the table has a sort key.
+
+Contributor Insights has to be enabled for the table (or index) first, with
+--enable (see the CloudWatch pricing; disable with --disable). The rules only see
+the traffic from then on, and take a few minutes to report it.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               insightsQueryCmd,
+	}
+)
+
+// ciRules are what the Contributor Insights rules of a table rank, by the
+// abbreviation in their names.
+var ciRules = map[string]string{
+	"PKC": "most accessed partition keys",
+	"PKT": "most throttled partition keys",
+	"SKC": "most accessed keys",
+	"SKT": "most throttled keys",
+}
+
+// ciRule returns what a rule ranks, i.e. DynamoDBContributorInsights-PKC-<table>-<id>.
+func ciRule(name string) string {
+	sp := strings.SplitN(name, "-", 3)
+	if len(sp) == 3 {
+		if v, ok := ciRules[sp[1]]; ok {
+			return v
+		}
+	}
+
+	return name
+}
+
+func insightsQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	log.SetFlags(0)
+	switch {
+	case cienable && cidisabl:
+		return usageErrorf("--enable and --disable are mutually exclusive")
+	case cisince <= 0:
+		return usageErrorf("invalid --since value: %v", cisince)
+	case cikeys < 1:
+		return usageErrorf("invalid --keys value: %v", cikeys)
+	}
+
+	var idx *string
+	if index != "" {
+		idx = aws.String(index)
+	}
+
+	if cienable || cidisabl {
+		action := dynamodb.ContributorInsightsActionEnable
+		if cidisabl {
+			action = dynamodb.ContributorInsightsActionDisable
+		}
+
+		out, err := svc.UpdateContributorInsights(&dynamodb.UpdateContributorInsightsInput{
+			TableName:                 t.TableName,
+			IndexName:                 idx,
+			ContributorInsightsAction: aws.String(action),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		log.Printf("contributor insights: %v\n", aws.StringValue(out.ContributorInsightsStatus))
+		return nil
+	}
+
+	ci, err := svc.DescribeContributorInsights(&dynamodb.DescribeContributorInsightsInput{
+		TableName: t.TableName,
+		IndexName: idx,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if status := aws.StringValue(ci.ContributorInsightsStatus); status != dynamodb.ContributorInsightsStatusEnabled {
+		return fmt.Errorf("%v: contributor insights is %v, see --enable", aws.StringValue(t.TableName), status)
+	}
+
+	sess, cnfs, err := newSession()
+	if err != nil {
+		return err
+	}
+
+	// One datapoint per minute, up to a day.
+	period := int64(60)
+	if cisince > 24*time.Hour {
+		period = 3600
+	}
+
+	cw := cloudwatch.New(sess, cnfs...)
+	now := time.Now()
+	for i, rule := range ci.ContributorInsightsRuleList {
+		out, err := cw.GetInsightRuleReport(&cloudwatch.GetInsightRuleReportInput{
+			RuleName:            rule,
+			StartTime:           aws.Time(now.Add(-cisince)),
+			EndTime:             aws.Time(now),
+			Period:              aws.Int64(period),
+			MaxContributorCount: aws.Int64(cikeys),
+			OrderBy:             aws.String("Sum"),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+
+		fmt.Printf("%v (%v), last %v:\n", ciRule(aws.StringValue(rule)), strings.Join(aws.StringValueSlice(out.KeyLabels), ", "), cisince)
+		if len(out.Contributors) == 0 {
+			fmt.Println("  (none)")
+		}
+
+		for n, c := range out.Contributors {
+			fmt.Printf("%5d  %10.0f  %v\n", n+1, aws.Float64Value(c.ApproximateAggregateValue), strings.Join(aws.StringValueSlice(c.Keys), ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+)
+
+// withContext makes all the api calls sent through svc, including the ones made
+// by pkg/lsdy, use ctx, so that they are aborted on --timeout or Ctrl-C.
+func withContext(ctx context.Context, svc *dynamodb.DynamoDB) {
+	svc.Handlers.Build.PushFront(func(r *request.Request) {
+		r.SetContext(ctx)
+	})
+}
+
+// pageLog records the items of each Query/Scan page sent through svc, along with
+// the LastEvaluatedKey of the last one, so that what was fetched so far can still
+// be displayed (and resumed) when the run is interrupted.
+type pageLog struct {
+	mu      sync.Mutex
+	items   []map[string]*dynamodb.AttributeValue
+	lastKey map[string]*dynamodb.AttributeValue
+}
+
+func (p *pageLog) instrument(svc *dynamodb.DynamoDB) {
+	svc.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error != nil {
+			return
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		switch out := r.Data.(type) {
+		case *dynamodb.QueryOutput:
+			p.items = append(p.items, out.Items...)
+			p.lastKey = out.LastEvaluatedKey
+		case *dynamodb.ScanOutput:
+			p.items = append(p.items, out.Items...)
+			p.lastKey = out.LastEvaluatedKey
+		}
+	})
+}
+
+// begin marks the start of a new query/scan.
+func (p *pageLog) begin() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastKey = nil
+}
+
+// fetched returns the items of all the pages received so far.
+func (p *pageLog) fetched() []map[string]*dynamodb.AttributeValue {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.items
+}
+
+// cursor returns the LastEvaluatedKey of the last page received as json, or an
+// empty string if there was none (i.e. the last page was complete).
+func (p *pageLog) cursor() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.lastKey) == 0 {
+		return ""
+	}
+
+	var m map[string]interface{}
+	if err := dynamodbattribute.UnmarshalMap(p.lastKey, &m); err != nil {
+		return ""
+	}
+
+	s, _ := lsdy.JSON(m)
+	return s
+}
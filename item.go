@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+)
+
+// fmtval returns the display string of an unmarshaled attribute value, based on
+// --set-sep and --binary, see lsdy.Format.
+func fmtval(v interface{}) string {
+	return lsdy.Format{SetSep: setsep, Binary: binmode}.Value(v)
+}
+
+// deleteItem deletes the item of t with the key attribute values, as displayed.
+// If old is set, the deleted item is returned, as it was (nil if none).
+func deleteItem(svc *dynamodb.DynamoDB, t *dynamodb.TableDescription, key map[string]string, old bool) (map[string]*dynamodb.AttributeValue, error) {
+	types := lsdy.KeyTypes(t)
+	k := make(map[string]*dynamodb.AttributeValue)
+	for name, v := range key {
+		av, err := lsdy.KeyValue(types[name], v)
+		if err != nil {
+			return nil, err
+		}
+
+		k[name] = av
+	}
+
+	if old {
+		return lsdy.DeleteItemOld(svc, *t.TableName, k)
+	}
+
+	return nil, lsdy.DeleteItem(svc, *t.TableName, k)
+}
+
+// keyFlags returns the key of the item given by --pk (and --sk), a single one of
+// each, i.e. for the commands that change an item.
+func keyFlags(t *dynamodb.TableDescription) (map[string]*dynamodb.AttributeValue, error) {
+	if len(pk) != 1 || len(sk) > 1 {
+		return nil, usageErrorf("expecting a single --pk (and --sk)")
+	}
+
+	return tableKey(t, append(pk[:1:1], sk...)...)
+}
+
+// tableKey returns the key of an item of t from <attr:value> values, which have
+// to be its key attributes.
+func tableKey(t *dynamodb.TableDescription, vals ...string) (map[string]*dynamodb.AttributeValue, error) {
+	types := lsdy.KeyTypes(t)
+	key := make(map[string]*dynamodb.AttributeValue)
+	for _, v := range vals {
+		sp := strings.SplitN(v, ":", 2)
+		if len(sp) != 2 || sp[0] == "" {
+			return nil, usageErrorf("invalid key format: %v", v)
+		}
+
+		av, err := lsdy.KeyValue(types[sp[0]], sp[1])
+		if err != nil {
+			return nil, usageError(err)
+		}
+
+		key[sp[0]] = av
+	}
+
+	for _, k := range t.KeySchema {
+		if _, ok := key[aws.StringValue(k.AttributeName)]; !ok {
+			return nil, usageErrorf("the key attribute %v is missing, see --pk/--sk", aws.StringValue(k.AttributeName))
+		}
+	}
+
+	if len(key) != len(t.KeySchema) {
+		return nil, usageErrorf("--pk/--sk are not the key attributes of %v", aws.StringValue(t.TableName))
+	}
+
+	return key, nil
+}
+
+// oldWriter returns the --return-values output, stdout if file is '-', and its
+// close function.
+func oldWriter(file string) (io.Writer, func() error, error) {
+	if file == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, f.Close, nil
+}
+
+// writeOld writes a deleted item to w as a line of dynamodb json, as stored, see
+// maskItem for the --mask/--hash attributes.
+func writeOld(w io.Writer, item map[string]*dynamodb.AttributeValue) error {
+	b, err := json.Marshal(avItem(item))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import "strings"
+
+// pairKeys returns the --pk/--sk pairs to query, one query each. The i'th --sk
+// goes with the i'th --pk, and can hold several sort keys of the same attribute
+// separated by ';', i.e. 'ts:2024-01;ts:2024-02', each queried under that pk.
+// With a single --pk, all the --sk values go with it.
+func pairKeys(pk, sk []string) ([]string, []string) {
+	groups := make([][]string, len(sk))
+	for i, v := range sk {
+		attr := strings.SplitN(v, ":", 2)[0] + ":"
+		for {
+			j := strings.Index(v, ";"+attr)
+			if j < 0 {
+				break
+			}
+
+			groups[i] = append(groups[i], v[:j])
+			v = v[j+1:]
+		}
+
+		groups[i] = append(groups[i], v)
+	}
+
+	if len(pk) == 1 && len(groups) > 1 {
+		var all []string
+		for _, g := range groups {
+			all = append(all, g...)
+		}
+
+		groups = [][]string{all}
+	}
+
+	var pks, sks []string
+	for i, v := range pk {
+		if i >= len(groups) {
+			pks, sks = append(pks, v), append(sks, "")
+			continue
+		}
+
+		for _, s := range groups[i] {
+			pks, sks = append(pks, v), append(sks, s)
+		}
+	}
+
+	return pks, sks
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// kinesisShard is the read state of a kinesis data stream shard.
+type kinesisShard struct {
+	parents    []string
+	typ        string  // first iterator type
+	iter       *string // nil if not yet (or no longer) available
+	seq        string  // last sequence number read
+	done       bool
+	caught     bool // last read was at the tip, or reached kinesisTailer.until
+	subscribed bool // with --efo
+}
+
+// kinesisEvent is what an enhanced fan-out subscription sends to poll.
+type kinesisEvent struct {
+	shard  string
+	recs   []*kinesis.Record
+	behind int64 // milliseconds behind the tip
+	end    bool  // the shard is closed
+	err    error
+}
+
+// kinesisTailer reads the change records of a table from its kinesis data stream
+// destination, parent shards first. The records are read with GetRecords, or
+// pushed through an enhanced fan-out consumer (--efo), which doesn't share the
+// shards' read throughput with the other consumers.
+type kinesisTailer struct {
+	svc      *kinesis.Kinesis
+	arn      string
+	table    string
+	from     time.Time // zero means new records only
+	until    time.Time // zero means no end
+	shards   map[string]*kinesisShard
+	started  bool
+	consumer string // enhanced fan-out consumer arn
+	owned    bool   // consumer registered by us, deregistered on close
+	events   chan kinesisEvent
+}
+
+// newKinesisTailer returns a tailer for the table's active kinesis data stream
+// destination.
+func newKinesisTailer(ctx context.Context, ddb *dynamodb.DynamoDB, svc *kinesis.Kinesis, table string, from, until time.Time) (*kinesisTailer, error) {
+	out, err := ddb.DescribeKinesisStreamingDestinationWithContext(ctx, &dynamodb.DescribeKinesisStreamingDestinationInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	k := &kinesisTailer{
+		svc:    svc,
+		table:  table,
+		from:   from,
+		until:  until,
+		shards: make(map[string]*kinesisShard),
+	}
+
+	for _, d := range out.KinesisDataStreamDestinations {
+		if aws.StringValue(d.DestinationStatus) == dynamodb.DestinationStatusActive {
+			k.arn = aws.StringValue(d.StreamArn)
+			break
+		}
+	}
+
+	if k.arn == "" {
+		return nil, fmt.Errorf("no stream (dynamodb or kinesis) enabled on table: %v", table)
+	}
+
+	if tailefo != "" {
+		if err := k.register(ctx, tailefo); err != nil {
+			return nil, err
+		}
+
+		k.events = make(chan kinesisEvent, 16)
+	}
+
+	if err := k.discover(ctx); err != nil {
+		k.close()
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// register gets (or registers) the named enhanced fan-out consumer, and waits
+// for it to be active.
+func (k *kinesisTailer) register(ctx context.Context, name string) error {
+	out, err := k.svc.DescribeStreamConsumerWithContext(ctx, &kinesis.DescribeStreamConsumerInput{
+		StreamARN:    aws.String(k.arn),
+		ConsumerName: aws.String(name),
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == kinesis.ErrCodeResourceNotFoundException {
+		r, err := k.svc.RegisterStreamConsumerWithContext(ctx, &kinesis.RegisterStreamConsumerInput{
+			StreamARN:    aws.String(k.arn),
+			ConsumerName: aws.String(name),
+		})
+		if err != nil {
+			return err
+		}
+
+		k.owned = true
+		out = &kinesis.DescribeStreamConsumerOutput{
+			ConsumerDescription: &kinesis.ConsumerDescription{
+				ConsumerARN:    r.Consumer.ConsumerARN,
+				ConsumerStatus: r.Consumer.ConsumerStatus,
+			},
+		}
+	} else if err != nil {
+		return err
+	}
+
+	for {
+		k.consumer = aws.StringValue(out.ConsumerDescription.ConsumerARN)
+		status := aws.StringValue(out.ConsumerDescription.ConsumerStatus)
+		if status == kinesis.ConsumerStatusActive {
+			return nil
+		}
+
+		debugf(1, "waiting for consumer %v: %v", name, status)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+
+		out, err = k.svc.DescribeStreamConsumerWithContext(ctx, &kinesis.DescribeStreamConsumerInput{
+			ConsumerARN: aws.String(k.consumer),
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// close deregisters the enhanced fan-out consumer, if registered by us.
+func (k *kinesisTailer) close() {
+	if !k.owned {
+		return
+	}
+
+	_, err := k.svc.DeregisterStreamConsumerWithContext(context.Background(), &kinesis.DeregisterStreamConsumerInput{
+		ConsumerARN: aws.String(k.consumer),
+	})
+	if err != nil {
+		log.Printf("deregister consumer %v: %v\n", k.consumer, err)
+	}
+}
+
+// discover adds the stream's shards that are not known yet. On the first call
+// without --from, only the open shards are read, starting from their tips.
+func (k *kinesisTailer) discover(ctx context.Context) error {
+	in := &kinesis.ListShardsInput{StreamARN: aws.String(k.arn)}
+	for {
+		out, err := k.svc.ListShardsWithContext(ctx, in)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range out.Shards {
+			id := aws.StringValue(s.ShardId)
+			if _, ok := k.shards[id]; ok {
+				continue
+			}
+
+			ks := &kinesisShard{typ: kinesis.ShardIteratorTypeTrimHorizon}
+			for _, p := range []*string{s.ParentShardId, s.AdjacentParentShardId} {
+				if p != nil {
+					ks.parents = append(ks.parents, *p)
+				}
+			}
+
+			switch {
+			case k.started:
+			case !k.from.IsZero():
+				ks.typ = kinesis.ShardIteratorTypeAtTimestamp
+			default:
+				ks.typ = kinesis.ShardIteratorTypeLatest
+				if s.SequenceNumberRange != nil && s.SequenceNumberRange.EndingSequenceNumber != nil {
+					ks.done = true // closed
+				}
+			}
+
+			k.shards[id] = ks
+		}
+
+		if out.NextToken == nil {
+			break
+		}
+
+		in = &kinesis.ListShardsInput{NextToken: out.NextToken}
+	}
+
+	k.started = true
+	return nil
+}
+
+// readable returns true if the parents of s, if known, are done.
+func (k *kinesisTailer) readable(s *kinesisShard) bool {
+	for _, id := range s.parents {
+		if p, ok := k.shards[id]; ok && !p.done {
+			return false
+		}
+	}
+
+	return true
+}
+
+// position returns where to (re)start reading s.
+func (k *kinesisTailer) position(s *kinesisShard) *kinesis.StartingPosition {
+	switch {
+	case s.seq != "":
+		return &kinesis.StartingPosition{
+			Type:           aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber),
+			SequenceNumber: aws.String(s.seq),
+		}
+	case s.typ == kinesis.ShardIteratorTypeAtTimestamp:
+		return &kinesis.StartingPosition{Type: aws.String(s.typ), Timestamp: aws.Time(k.from)}
+	default:
+		return &kinesis.StartingPosition{Type: aws.String(s.typ)}
+	}
+}
+
+// subscribe reads shard id through the enhanced fan-out consumer, sending the
+// records to k.events, until the shard is closed. Subscriptions expire after 5
+// minutes, and are renewed after the last record read.
+func (k *kinesisTailer) subscribe(ctx context.Context, id string, pos *kinesis.StartingPosition) {
+	send := func(e kinesisEvent) bool {
+		select {
+		case k.events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for ctx.Err() == nil {
+		out, err := k.svc.SubscribeToShardWithContext(ctx, &kinesis.SubscribeToShardInput{
+			ConsumerARN:      aws.String(k.consumer),
+			ShardId:          aws.String(id),
+			StartingPosition: pos,
+		})
+		if err != nil {
+			send(kinesisEvent{shard: id, err: err})
+			return
+		}
+
+		stream := out.GetStream()
+		for ev := range stream.Events() {
+			e, ok := ev.(*kinesis.SubscribeToShardEvent)
+			if !ok {
+				continue
+			}
+
+			if !send(kinesisEvent{shard: id, recs: e.Records, behind: aws.Int64Value(e.MillisBehindLatest)}) {
+				stream.Close()
+				return
+			}
+
+			if e.ContinuationSequenceNumber == nil {
+				stream.Close()
+				send(kinesisEvent{shard: id, end: true})
+				return
+			}
+
+			pos = &kinesis.StartingPosition{
+				Type:           aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber),
+				SequenceNumber: e.ContinuationSequenceNumber,
+			}
+		}
+
+		stream.Close()
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			send(kinesisEvent{shard: id, err: err})
+			return
+		}
+	}
+}
+
+// kinesisChange is the (json) data of a kinesis data stream record.
+type kinesisChange struct {
+	EventName string `json:"eventName"`
+	TableName string `json:"tableName"`
+	Dynamodb  struct {
+		ApproximateCreationDateTime          int64
+		ApproximateCreationDateTimePrecision string // MILLISECOND (default), or MICROSECOND
+		Keys                                 map[string]*dynamodb.AttributeValue
+		NewImage                             map[string]*dynamodb.AttributeValue
+		OldImage                             map[string]*dynamodb.AttributeValue
+	} `json:"dynamodb"`
+}
+
+// decode returns r as a dynamodb stream record, or nil if it's from another
+// table, since a kinesis data stream can be shared.
+func (k *kinesisTailer) decode(r *kinesis.Record) (*dynamodbstreams.Record, error) {
+	var c kinesisChange
+	if err := json.Unmarshal(r.Data, &c); err != nil {
+		return nil, err
+	}
+
+	if c.TableName != "" && c.TableName != k.table {
+		return nil, nil
+	}
+
+	at := time.UnixMilli(c.Dynamodb.ApproximateCreationDateTime)
+	if c.Dynamodb.ApproximateCreationDateTimePrecision == "MICROSECOND" {
+		at = time.UnixMicro(c.Dynamodb.ApproximateCreationDateTime)
+	}
+
+	return &dynamodbstreams.Record{
+		EventName: aws.String(c.EventName),
+		Dynamodb: &dynamodbstreams.StreamRecord{
+			ApproximateCreationDateTime: &at,
+			Keys:                        c.Dynamodb.Keys,
+			NewImage:                    c.Dynamodb.NewImage,
+			OldImage:                    c.Dynamodb.OldImage,
+			SequenceNumber:              r.SequenceNumber,
+		},
+	}, nil
+}
+
+// poll reads the available records of the shards whose parents are done, sorted
+// by their approximate creation time.
+func (k *kinesisTailer) poll(ctx context.Context) ([]*dynamodbstreams.Record, error) {
+	var recs []*dynamodbstreams.Record
+	take := func(s *kinesisShard, in []*kinesis.Record, behind int64) {
+		s.caught = behind == 0
+		for _, r := range in {
+			s.seq = aws.StringValue(r.SequenceNumber)
+			c, err := k.decode(r)
+			if err != nil {
+				debugf(1, "skipping kinesis record %v: %v", s.seq, err)
+				continue
+			}
+
+			if c == nil {
+				continue
+			}
+
+			at := aws.TimeValue(c.Dynamodb.ApproximateCreationDateTime)
+			if !k.until.IsZero() && !at.Before(k.until) {
+				s.caught = true
+				continue
+			}
+
+			if !k.from.IsZero() && at.Before(k.from) {
+				continue
+			}
+
+			recs = append(recs, c)
+		}
+	}
+
+	closed := false
+	for id, s := range k.shards {
+		if s.done || !k.readable(s) {
+			continue
+		}
+
+		if k.consumer != "" {
+			if !s.subscribed {
+				s.subscribed = true
+				go k.subscribe(ctx, id, k.position(s))
+			}
+
+			continue
+		}
+
+		if s.iter == nil {
+			p := k.position(s)
+			out, err := k.svc.GetShardIteratorWithContext(ctx, &kinesis.GetShardIteratorInput{
+				StreamARN:              aws.String(k.arn),
+				ShardId:                aws.String(id),
+				ShardIteratorType:      p.Type,
+				StartingSequenceNumber: p.SequenceNumber,
+				Timestamp:              p.Timestamp,
+			})
+			if err != nil {
+				return recs, err
+			}
+
+			s.iter = out.ShardIterator
+		}
+
+		out, err := k.svc.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{ShardIterator: s.iter})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == kinesis.ErrCodeExpiredIteratorException {
+				s.iter, s.caught = nil, false // get a new one after s.seq on the next poll
+				continue
+			}
+
+			return recs, err
+		}
+
+		take(s, out.Records, aws.Int64Value(out.MillisBehindLatest))
+		s.iter = out.NextShardIterator
+		if s.iter == nil {
+			s.done, closed = true, true
+		}
+	}
+
+	// The enhanced fan-out subscriptions push their records in between polls.
+	for drained := false; !drained; {
+		select {
+		case e := <-k.events:
+			s := k.shards[e.shard]
+			switch {
+			case e.err != nil:
+				return recs, fmt.Errorf("subscription to %v: %v", e.shard, e.err)
+			case e.end:
+				s.done, closed = true, true
+			default:
+				take(s, e.recs, e.behind)
+			}
+		default:
+			drained = true
+		}
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		return aws.TimeValue(recs[i].Dynamodb.ApproximateCreationDateTime).Before(aws.TimeValue(recs[j].Dynamodb.ApproximateCreationDateTime))
+	})
+
+	if closed {
+		return recs, k.discover(ctx) // the closed shards' children
+	}
+
+	return recs, nil
+}
+
+// done returns true if the stream has been read up to k.until.
+func (k *kinesisTailer) done() bool {
+	if k.until.IsZero() || time.Now().Before(k.until) {
+		return false
+	}
+
+	for _, s := range k.shards {
+		if !s.done && !s.caught {
+			return false
+		}
+	}
+
+	return true
+}
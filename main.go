@@ -1,25 +1,25 @@
 package main
 
 import (
-	"encoding/base64"
+	"context"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"regexp"
-	"sort"
+	"os/signal"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/flowerinthenight/libdy"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -29,16 +29,85 @@ var (
 	rolearn  string
 	pk       []string
 	sk       []string
+	skbetw   string
+	transact bool
 	incols   []string
 	contains []string
 	limit    int64
+	keylimit int64
+	skip     int64
+	pagesize int64
+	index    string
+	filters  []string
+	explain  bool
+	scanwarn float64
+	scanmax  float64
+	force    bool
 	describe bool
 	nosort   bool
 	noborder bool
 	del      bool
+	retvals  string
+	auditlog string
+	auditcwl string
 	csvf     string
+	csvstrct bool
+	csvhdr   []string
+	csvapnd  bool
 	b64dec   []string
-	maxlen   int
+	maxlen   string
+	top      string
+	bottom   string
+	sortby   []string
+	dedupe   []string
+	rename   []string
+	colorder []string
+	flat     bool
+	flatlvl  int
+	explattr string
+	xforms   []string
+	setsep   string
+	binmode  string
+	protos   []string
+	execs    []string
+	execbat  int
+	scriptf  string
+	validate string
+	expiring string
+	masks    []string
+	hashf    []string
+	details  []int
+	fit      bool
+	wrap     bool
+	colorf   string
+	nocolor  bool
+	zebra    bool
+	colrules []string
+	vert     bool
+	transp   bool
+	keysonly bool
+	outtmpl  string
+	pipecmd  string
+	nopager  bool
+	rownum   bool
+	tmpldir  string
+	quiet    bool
+	failemp  bool
+	summary  string
+	verbose  int
+	otlp     string
+	proxy    string
+	cabundle string
+	timeout  time.Duration
+	fips     bool
+	dualstk  bool
+	cfgfile  string
+	profile  string
+	nohist   bool
+	envname  string
+	watch    time.Duration
+	cachettl time.Duration
+	offline  bool
 
 	rootCmd = &cobra.Command{
 		Use:   "lsdy <table>",
@@ -58,90 +127,169 @@ You can also specify them using the provided flags (see -h). If ROLE_ARN (--role
 is specified, this tool will assume that role using the provided key/secret pair.
 
 To query multiple pk/sk combinations, you can add more --pk flags with its corresponding
---sk inputs (same index).`,
+--sk inputs (same index).
+
+Default values for any of the flags can be set in ~/.config/lsdy/config.yaml (see --config).`,
+		Args: cobra.ArbitraryArgs,
 		RunE: run,
 	}
 )
 
 func run(cmd *cobra.Command, args []string) error {
-	log.SetFlags(0)
-	log.SetOutput(os.Stdout)
+	log.SetFlags(0) // diagnostics go to stderr, data to stdout
+	var prefix string
+	if cfgfile != "" {
+		must := cmd.Flags().Changed("config") || envname != ""
+		var err error
+		prefix, err = loadConfig(cmd.Flags(), cfgfile, must)
+		if err != nil {
+			return err
+		}
+	}
+
+	stats := newRunStats()
 	if len(args) == 0 {
-		return fmt.Errorf("<table> cannot be empty")
+		return usageErrorf("<table> cannot be empty")
 	}
 
-	// Validate pk and sk inputs.
-	var pklbl, sklbl string
-	for _, v := range pk {
-		if v != "" {
-			if !strings.Contains(v, ":") {
-				return fmt.Errorf("invalid --pk format: %v", v)
-			}
+	if watch > 0 && del {
+		return usageErrorf("--delete is not supported with --watch")
+	}
 
-			// Expected to be the same across all inputs.
-			pklbl = strings.Split(v, ":")[0]
-		}
+	if watch > 0 && wstate == nil {
+		return watchRun(cmd, args)
 	}
 
-	for _, v := range sk {
-		if v != "" {
-			if !strings.Contains(v, ":") {
-				return fmt.Errorf("invalid --sk format: %v", v)
-			}
+	// The history keeps the table name as given.
+	given := args[0]
+	args = append([]string{prefix + args[0]}, args[1:]...)
+	stats.table = args[0]
 
-			// Expected to be the same across all inputs.
-			sklbl = strings.Split(v, ":")[0]
+	if otlp != "" {
+		shutdown, err := setupTracing(otlp)
+		if err != nil {
+			return err
 		}
+
+		defer shutdown()
 	}
 
-	sess, _ := session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewStaticCredentials(key, secret, ""),
-	})
+	ctx, span := tracer.Start(context.Background(), "lsdy", trace.WithAttributes(attribute.String("aws.dynamodb.table", args[0])))
+	defer span.End()
+
+	// Ctrl-C stops the fetch, the rest is displayed; a second one exits.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	var svc *dynamodb.DynamoDB
-	if rolearn != "" {
-		cnf := &aws.Config{Credentials: stscreds.NewCredentials(sess, rolearn)}
-		svc = dynamodb.New(sess, cnf)
-	} else {
-		svc = dynamodb.New(sess)
+	pklbl, sklbl, err := checkFlags()
+	if err != nil {
+		return err
 	}
 
-	var err error
-	var f *os.File
-	var cw *csv.Writer
-	if csvf != "" {
-		f, err = os.Create(fmt.Sprintf("%v", csvf))
+	var tmpl *template.Template
+	if outtmpl != "" {
+		tmpl, err = loadTemplate(outtmpl)
 		if err != nil {
 			return err
 		}
+	}
 
-		cw = csv.NewWriter(f)
-		defer func() {
-			cw.Flush()
-			f.Close()
-		}()
+	var window time.Duration
+	if expiring != "" {
+		window, err = parseWindow(expiring)
+		if err != nil {
+			return err
+		}
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetAutoFormatHeaders(false)
-	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetColWidth(maxlen)
-	if noborder {
-		table.SetBorder(false)
-		table.SetHeaderLine(false)
-		table.SetColumnSeparator("")
-		table.SetTablePadding("  ")
-		table.SetNoWhiteSpace(true)
+	filter, err := filterCond(filters)
+	if err != nil {
+		return err
 	}
 
-	// Get table information.
-	t, err := svc.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(args[0])})
+	widths, err := parseMaxlen(maxlen, tablewriter.MAX_ROW_WIDTH)
 	if err != nil {
 		return err
 	}
 
+	p, err := newPipeline(cmd, widths)
+	if err != nil {
+		return err
+	}
+
+	execspecs, err := parseExecs(execs)
+	if err != nil {
+		return err
+	}
+
+	svc, err := newService()
+	if err != nil {
+		return err
+	}
+
+	stats.instrument(svc)
+
+	traceCalls(ctx, svc)
+	withContext(ctx, svc)
+	pages := &pageLog{}
+	pages.instrument(svc)
+	if verbose > 0 {
+		debugf(1, "region=%v, key=%v, secret=%v, rolearn=%v", region, redact(key), redact(secret), rolearn)
+		traceRequests(svc)
+	}
+
+	if csvf == "-" {
+		// Stdout is reserved for the csv output, for this run only, not the next
+		// ones of the shell, or --watch.
+		defer func(q bool) { quiet = q }(quiet)
+		quiet = true
+	}
+
+	o, err := newRunOutput(widths, tmpl)
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	defer o.close()
+
+	// The cached items (and table description) are used if fresh enough, or
+	// regardless of age with --offline.
+	var cached *cacheEntry
+	if offline || (cachettl > 0 && !del) {
+		cached, err = readCache(querySig(args[0]))
+		switch {
+		case err != nil && offline:
+			return err
+		case err != nil:
+			debugf(1, "cache: %v", err)
+		case !offline && time.Since(cached.Time) > cachettl:
+			cached = nil
+		}
+	}
+
+	// Get table information.
+	var t *dynamodb.DescribeTableOutput
+	if cached != nil {
+		t = cached.Table
+	} else {
+		t, err = describeTable(svc, args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	pkattr, skattr := pklbl, sklbl // as queried
 	for _, v := range t.Table.KeySchema {
 		if *v.KeyType == "HASH" {
 			pklbl = *v.AttributeName
@@ -157,66 +305,107 @@ func run(cmd *cobra.Command, args []string) error {
 		log.Println("")
 	}
 
-	var items []map[string]*dynamodb.AttributeValue
-	var m []map[string]interface{}
-	if len(pk) > 0 {
-		for i, v := range pk {
-			var vv string
-			if len(sk) > 0 {
-				if i <= len(sk)-1 {
-					vv = sk[i]
+	// Query the index keyed by the --pk (and --sk) attributes, if they are not
+	// the table's keys.
+	qindex := index
+	if pkattr != "" && index == "" && (pkattr != pklbl || skattr != "" && skattr != sklbl) {
+		if name, ok := keyIndex(t.Table, pkattr, skattr); ok {
+			qindex = name
+			if !quiet {
+				keys := pkattr
+				if skattr != "" {
+					keys += ", " + skattr
 				}
-			}
 
-			var tmp []map[string]*dynamodb.AttributeValue
-			if limit > 0 {
-				tmp, err = libdy.GetItems(svc, args[0], v, vv, limit)
-			} else {
-				tmp, err = libdy.GetItems(svc, args[0], v, vv)
+				log.Printf("the key of the table is not %v, querying the index %v\n", keys, name)
 			}
+		}
+	}
 
-			if err != nil {
-				return err
-			}
+	// Only the items expiring within the window are fetched.
+	var ttlattr string
+	if expiring != "" {
+		ttlattr, err = ttlAttr(svc, args[0])
+		if err != nil {
+			return err
+		}
 
-			// Accumulate results to items.
-			items = append(items, tmp...)
+		c := expiringCond(ttlattr, time.Now().Add(window))
+		if filter != nil {
+			c = expression.And(*filter, c)
 		}
-	} else {
-		if limit > 0 {
-			items, err = libdy.ScanItems(svc, args[0], limit)
-		} else {
-			items, err = libdy.ScanItems(svc, args[0])
+
+		filter = &c
+	}
+
+	// Only the keys are fetched (and the ttl, for the counts), and displayed.
+	var keycols, proj []string
+	if keysonly {
+		keycols = []string{pklbl}
+		if sklbl != "" {
+			keycols = append(keycols, sklbl)
 		}
 
+		proj = append(proj, keycols...)
+		if ttlattr != "" {
+			proj = append(proj, ttlattr)
+		}
+	}
+
+	var val *validator
+	if validate != "" {
+		val, err = newValidator(validate, pklbl, sklbl)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = dynamodbattribute.UnmarshalListOfMaps(items, &m)
+	// The skipped rows are fetched too.
+	fetchlim := limit
+	if limit > 0 {
+		fetchlim += skip
+	}
+
+	f := &fetchSpec{
+		table:  args[0],
+		t:      t,
+		cached: cached,
+		index:  qindex,
+		filter: filter,
+		proj:   proj,
+		limit:  fetchlim,
+		key:    fmt.Sprint(args[0], pk, sk, skbetw, transact, fetchlim, keylimit, index, filters, expiring, keysonly),
+		pages:  pages,
+	}
+
+	items, err := f.items(ctx, svc)
 	if err != nil {
 		return err
 	}
 
-	lbl := make(map[string]struct{})
-	sortedlbl := []string{}
-	if len(incols) > 0 {
-		sortedlbl = incols
-	} else {
-		for _, maps := range m {
-			for k, _ := range maps {
-				lbl[k] = struct{}{}
-			}
-		}
+	stats.Fetched = len(items)
+	stats.throttled()
+	debugf(1, "fetched %v items", len(items))
+	m, err := lsdy.UnmarshalItems(items)
+	if err != nil {
+		return err
 	}
 
-	for k := range lbl {
-		sortedlbl = append(sortedlbl, k)
+	if expiring != "" && !quiet {
+		logExpiry(m, ttlattr, expiring)
 	}
 
-	if !nosort {
-		sort.Strings(sortedlbl)
+	// As stored, before the display flags.
+	if val != nil {
+		stats.Invalid, err = val.check(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	m, sortedlbl, err := buildRows(p, execspecs, keycols, pklbl, sklbl, m)
+	if err != nil {
+		return err
 	}
 
 	if describe {
@@ -229,130 +418,438 @@ func run(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	var hdrs []string
-	for _, v := range sortedlbl {
-		hdrs = append(hdrs, fmt.Sprintf("%v", v))
+	out, err := o.render(args[0], p, m, sortedlbl, pklbl, sklbl)
+	if err != nil {
+		return err
+	}
+
+	if err := o.stdout.close(); err != nil {
+		cmd.SilenceUsage = true
+		return err
 	}
 
-	table.SetHeader(hdrs)
-	if csvf != "" {
-		cw.Write(hdrs)
+	if !quiet {
+		stats.footer(len(out))
 	}
 
-	todel := make(map[string]string) // key=sk, val=pk
-	for _, maps := range m {
-		include := true
-		var rows []string
-		var qrows []string
-		for i, k := range sortedlbl {
-			if _, ok := maps[k]; !ok {
-				rows = append(rows, "-")
-				qrows = append(qrows, "-")
-				continue
+	if rowsink != nil {
+		if err := rowsink(out, p.Full); err != nil {
+			return err
+		}
+	}
+
+	// If there are items to delete.
+	var todel map[string]string
+	var delfail int
+	if del {
+		todel = deleteKeys(out, pklbl, sklbl)
+		delfail, err = deleteRows(ctx, svc, t.Table, p, todel, pklbl, sklbl, stats)
+		if err != nil {
+			return err
+		}
+
+		if len(todel) > 0 {
+			audit(args[0], "delete", stats.Deleted, delfail, changedFlags(cmd.Flags(), "config", "no-history"))
+		}
+	}
+
+	stats.Rows = len(out)
+	lastrun = stats
+	if summary != "" {
+		if err := stats.write(summary); err != nil {
+			return err
+		}
+	}
+
+	if !nohist && (wstate == nil || wstate.n == 0) {
+		addHistory(given, changedFlags(cmd.Flags(), "config", "no-history"), len(out))
+	}
+
+	if ctx.Err() != nil {
+		cmd.SilenceUsage = true
+		return &codeError{exitInterrupted, fmt.Errorf("interrupted: %v", ctx.Err())}
+	}
+
+	if delfail > 0 {
+		cmd.SilenceUsage = true
+		return &codeError{exitDelete, fmt.Errorf("%v of %v deletes failed", delfail, len(todel))}
+	}
+
+	if stats.Invalid > 0 {
+		cmd.SilenceUsage = true
+		return &codeError{exitInvalid, fmt.Errorf("%v of %v items failed --validate", stats.Invalid, stats.Fetched)}
+	}
+
+	if failemp && len(out) == 0 {
+		cmd.SilenceUsage = true
+		return &codeError{exitEmpty, fmt.Errorf("no matching rows")}
+	}
+
+	return nil
+}
+
+// checkFlags validates the flags of run that don't need the table, and returns
+// the key attributes of --pk, and --sk (or --sk-between), as queried.
+func checkFlags() (string, string, error) {
+	var pklbl, sklbl string
+	for _, v := range pk {
+		if v != "" {
+			if !strings.Contains(v, ":") {
+				return "", "", usageErrorf("invalid --pk format: %v", v)
 			}
 
-			row := fmt.Sprintf("%v", maps[k])
-			for _, decv := range b64dec {
-				sp := strings.Split(decv, ":")
-				switch {
-				case len(sp) == 1: // '0', '2', ...
-					idx, _ := strconv.Atoi(sp[0])
-					if idx == i {
-						data, err := base64.StdEncoding.DecodeString(row)
-						if err == nil {
-							row = string(data)
-						}
-					}
-				case len(sp) == 3: // '1:|:3'
-					idx, _ := strconv.Atoi(sp[0])
-					sidx, _ := strconv.Atoi(sp[2])
-					if idx == i {
-						sr := strings.Split(row, sp[1])
-						if len(sr) > 1 && sidx < len(sr) {
-							data, err := base64.StdEncoding.DecodeString(sr[sidx])
-							if err == nil {
-								sr[sidx] = string(data)
-								row = strings.Join(sr, sp[1])
-							}
-						}
-					}
-				}
+			// Expected to be the same across all inputs.
+			pklbl = strings.Split(v, ":")[0]
+		}
+	}
+
+	for _, v := range sk {
+		if v != "" {
+			if !strings.Contains(v, ":") {
+				return "", "", usageErrorf("invalid --sk format: %v", v)
 			}
 
-			for _, fltr := range contains {
-				cc := strings.Split(fltr, ":") // '0:[[!]regex:]expr'
-				switch {
-				case len(cc) == 2: // not regex
-					idx, _ := strconv.Atoi(cc[0])
-					if idx == i {
-						if cc[1][0] == '^' {
-							if strings.Contains(row, cc[1][1:]) {
-								include = false
-							}
-						} else {
-							include = false
-							if strings.Contains(row, cc[1]) {
-								include = true
-							}
-						}
-					}
-				case len(cc) == 3: // regex version
-					idx, _ := strconv.Atoi(cc[0])
-					if idx == i {
-						re := regexp.MustCompile(cc[2])
-						match := re.MatchString(row)
-						switch cc[1] {
-						case "^regex":
-							include = !match
-						case "regex":
-							include = match
-						}
-					}
-				}
+			// Expected to be the same across all inputs.
+			sklbl = strings.Split(v, ":")[0]
+		}
+	}
+
+	if skbetw != "" {
+		switch {
+		case len(pk) == 0:
+			return "", "", usageErrorf("--sk-between needs --pk")
+		case len(sk) > 0:
+			return "", "", usageErrorf("--sk and --sk-between are mutually exclusive")
+		case strings.Count(skbetw, ":") < 2:
+			return "", "", usageErrorf("invalid --sk-between format: %v", skbetw)
+		}
+
+		sklbl = strings.Split(skbetw, ":")[0]
+	}
+
+	if transact {
+		switch {
+		case len(pk) == 0:
+			return "", "", usageErrorf("--transact needs --pk")
+		case skbetw != "", index != "", len(filters) > 0, expiring != "":
+			return "", "", usageErrorf("--transact is not supported with --sk-between, --index, --filter, or --expiring")
+		}
+	}
+
+	if vert && transp {
+		return "", "", usageErrorf("--vertical and --transpose are mutually exclusive")
+	}
+
+	if skip < 0 {
+		return "", "", usageErrorf("invalid --skip value: %v", skip)
+	}
+
+	if keylimit < 0 {
+		return "", "", usageErrorf("invalid --limit-per-key value: %v", keylimit)
+	}
+
+	if pagesize < 0 {
+		return "", "", usageErrorf("invalid --page-size value: %v", pagesize)
+	}
+
+	if keysonly && (vert || transp || validate != "") {
+		return "", "", usageErrorf("--keys-only is not supported with --vertical, --transpose, or --validate")
+	}
+
+	if outtmpl != "" && (vert || transp || keysonly) {
+		return "", "", usageErrorf("--template is not supported with --vertical, --transpose, or --keys-only")
+	}
+
+	if offline && del {
+		return "", "", usageErrorf("--delete is not supported with --offline")
+	}
+
+	// The script can change, add, or drop items, so the keys of its output are
+	// not necessarily the ones stored.
+	if scriptf != "" && del {
+		return "", "", usageErrorf("--delete is not supported with --script")
+	}
+
+	if retvals != "" && !del {
+		return "", "", usageErrorf("--return-values needs --delete")
+	}
+
+	if csvapnd && (csvf == "" || csvf == "-") {
+		return "", "", usageErrorf("--csv-append needs a --csv file")
+	}
+
+	if expiring != "" && offline {
+		return "", "", usageErrorf("--expiring is not supported with --offline")
+	}
+
+	return pklbl, sklbl, nil
+}
+
+// buildRows prepares the fetched items for p (see prepareItems), and returns them,
+// along with their columns, in order. keycols are the columns of --keys-only.
+func buildRows(p *lsdy.Pipeline, execs []*execSpec, keycols []string, pklbl, sklbl string, m []map[string]interface{}) ([]map[string]interface{}, []string, error) {
+	var sc *script
+	if scriptf != "" {
+		var err error
+		sc, err = newScript(scriptf)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	m, err := prepareItems(p, sc, execs, m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Columns given through --attr (or --keys-only) are displayed in the order given.
+	if keysonly {
+		p.Attrs = keycols
+	}
+
+	p.Pin = pinned(pklbl, sklbl)
+	return m, p.Columns(m), nil
+}
+
+// runOutput is where the rows of a run go: the table (or the keys, or
+// --template) to stdout, and the --csv file.
+type runOutput struct {
+	stdout *output
+	cw     *csv.Writer
+	f      *os.File // of --csv, if not stdout
+	csvold []string // header of the file appended to, if any
+	rnd    *lsdy.Render
+	tmpl   *template.Template
+}
+
+// newRunOutput returns the output of run, paged (or piped) as set, see newOutput.
+func newRunOutput(widths *colWidths, tmpl *template.Template) (*runOutput, error) {
+	// Not paged in the shell, or with --watch, or for scripts.
+	stdout, err := newOutput(!quiet && csvf != "-" && watch == 0 && shcache == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &runOutput{stdout: stdout, tmpl: tmpl}
+	switch {
+	case csvf == "-":
+		o.cw = csv.NewWriter(stdout)
+	case csvf != "":
+		o.f, o.csvold, err = openCSV(csvf, csvapnd)
+		if err != nil {
+			stdout.close()
+			return nil, err
+		}
+
+		o.cw = csv.NewWriter(o.f)
+	}
+
+	if o.cw != nil {
+		o.cw.UseCRLF = csvstrct
+	}
+
+	// With --wrap, we do our own wrapping.
+	o.rnd = &lsdy.Render{ColWidth: widths.max(), NoWrap: wrap, NoBorder: noborder, Shorten: shorten}
+	switch {
+	case vert:
+		o.rnd.Layout = lsdy.VerticalLayout
+	case transp:
+		o.rnd.Layout = lsdy.TransposeLayout
+	case fit:
+		o.rnd.Fit = termWidth()
+	}
+
+	return o, nil
+}
+
+// close flushes the csv rows, and closes the file, and stdout, if not yet.
+func (o *runOutput) close() {
+	if o.cw != nil {
+		o.cw.Flush()
+	}
+
+	if o.f != nil {
+		o.f.Close()
+	}
+
+	o.stdout.close()
+}
+
+// render writes the rows of the items of table, in the cols columns, to the csv
+// file, and stdout, along with the --detail rows, and returns them. The csv rows
+// are flushed, and stdout is left to the caller to close, i.e. to page it.
+func (o *runOutput) render(table string, p *lsdy.Pipeline, m []map[string]interface{}, cols []string, pklbl, sklbl string) ([]lsdy.Row, error) {
+	hdrs := p.Headers(cols)
+	csvhdrs, err := csvHeaders(p, cols, hdrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*colorRule
+	for _, v := range colrules {
+		rule, err := parseColorRule(v)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if useColor() {
+		o.rnd.Colors = func(i int, r lsdy.Row, n int) []tablewriter.Colors { return rowColors(i, r, rules, n) }
+	}
+
+	switch {
+	case o.cw != nil && o.csvold == nil:
+		o.cw.Write(csvhdrs)
+	case o.csvold != nil && strings.Join(o.csvold, ",") != strings.Join(csvhdrs, ","):
+		log.Printf("warning: the header of %v (%v) differs from the columns appended (%v)\n", csvf, strings.Join(o.csvold, ","), strings.Join(csvhdrs, ","))
+	}
+
+	xferrs := transformErrors(p)
+	out := p.Rows(m, cols)
+	xferrs()
+
+	if shcache != nil {
+		out = shcache.page(out)
+	}
+
+	if wstate != nil {
+		out = wstate.diff(out, cols, pklbl, sklbl)
+		hdrs = append([]string{""}, hdrs...)
+	}
+
+	// Numbered after filtering (and paging in the shell), as for --detail.
+	if rownum {
+		hdrs = o.rnd.Number(hdrs, out)
+	}
+
+	if o.cw != nil {
+		for _, r := range out {
+			if r.Mark != "-" { // removed since the previous --watch run, display only
+				o.cw.Write(r.CSV)
+			}
+		}
+	}
+
+	// Final table render.
+	switch {
+	case quiet:
+	case keysonly:
+		for i, r := range out {
+			if r.Mark == "-" {
+				continue // removed since the previous --watch run
+			}
+
+			var keys []string
+			if rownum {
+				keys = append(keys, strconv.Itoa(i+1))
 			}
 
-			rows = append(rows, row)
-			if len(row) > maxlen {
-				row = row[:maxlen]
+			for _, k := range cols {
+				v, _ := p.Redact(k, fmtval(r.Item[k]))
+				keys = append(keys, k+":"+v)
 			}
 
-			row = strings.Replace(row, "\"", "'", -1)
-			qrows = append(qrows, fmt.Sprintf("%v", row))
+			fmt.Fprintln(o.stdout, strings.Join(keys, "\t"))
+		}
+	case o.tmpl != nil:
+		data := tmplData{Table: table, Cols: cols}
+		for _, r := range out {
+			if r.Mark != "-" { // removed since the previous --watch run
+				data.Items = append(data.Items, p.Full(r))
+			}
 		}
 
-		if !include {
+		data.Count = len(data.Items)
+		if err := o.tmpl.Execute(o.stdout, data); err != nil {
+			return nil, fmt.Errorf("--template: %v", err)
+		}
+	default:
+		o.rnd.Write(o.stdout, hdrs, out)
+	}
+
+	for _, n := range details {
+		if n < 1 || n > len(out) {
+			log.Printf("detail: row %v out of range [1-%v]\n", n, len(out))
 			continue
 		}
 
-		table.Append(rows)
-		if csvf != "" {
-			cw.Write(qrows)
+		v, err := lsdy.JSONIndent(p.Full(out[n-1]))
+		if err != nil {
+			return nil, err
 		}
 
-		// Setup the items to delete, if set.
-		if del {
-			if _, ok := maps[sklbl]; ok {
-				todel[fmt.Sprintf("%v", maps[sklbl])] = fmt.Sprintf("%v", maps[pklbl])
-			}
+		fmt.Fprintln(o.stdout, "")
+		fmt.Fprintf(o.stdout, "Row %v:\n", n)
+		fmt.Fprintln(o.stdout, v)
+	}
+
+	// The output is complete, page it (or wait for --pipe) before the deletes.
+	if o.cw != nil {
+		o.cw.Flush()
+	}
+
+	return out, nil
+}
+
+// deleteKeys returns the keys of the --delete rows, as displayed, sk to pk.
+func deleteKeys(out []lsdy.Row, pklbl, sklbl string) map[string]string {
+	todel := make(map[string]string) // key=sk, val=pk
+	for _, r := range out {
+		if r.Mark == "-" {
+			continue // removed since the previous --watch run, display only
+		}
+
+		if _, ok := r.Item[sklbl]; ok {
+			todel[fmt.Sprintf("%v", r.Item[sklbl])] = fmt.Sprintf("%v", r.Item[pklbl])
 		}
 	}
 
-	// Final table render.
-	table.Render()
+	return todel
+}
 
-	// If there are items to delete.
-	if del {
-		for k, v := range todel {
-			err = libdy.DeleteItem(svc, args[0], pklbl+":"+v, sklbl+":"+k)
-			if err != nil {
-				log.Printf("delete failed: [key:%v, sortkey:%v] %v\n", v, k, err)
-			} else {
-				log.Printf("deleted: key:%v, sortkey:%v\n", v, k)
+// deleteRows deletes the todel items of t, writing them to --return-values if
+// set, until ctx is done. It returns the number of failed deletes.
+func deleteRows(ctx context.Context, svc *dynamodb.DynamoDB, t *dynamodb.TableDescription, p *lsdy.Pipeline, todel map[string]string, pklbl, sklbl string, stats *runStats) (int, error) {
+	var ow io.Writer
+	if retvals != "" {
+		w, closefn, err := oldWriter(retvals)
+		if err != nil {
+			return 0, err
+		}
+
+		defer closefn()
+		ow = w
+	}
+
+	var delfail int
+	for k, v := range todel {
+		if ctx.Err() != nil {
+			log.Printf("delete stopped: %v\n", ctx.Err())
+			break
+		}
+
+		old, err := deleteItem(svc, t, map[string]string{pklbl: v, sklbl: k}, ow != nil)
+		if err != nil {
+			delfail++
+			log.Printf("delete failed: [key:%v, sortkey:%v] %v\n", v, k, err)
+			continue
+		}
+
+		stats.Deleted++
+		if !quiet {
+			log.Printf("deleted: key:%v, sortkey:%v\n", v, k)
+		}
+
+		if ow != nil && old != nil {
+			if err := writeOld(ow, maskItem(old, p)); err != nil {
+				return delfail, err
 			}
 		}
 	}
 
-	return nil
+	return delfail, nil
 }
 
 func main() {
@@ -360,18 +857,150 @@ func main() {
 	rootCmd.Flags().StringVar(&region, "region", os.Getenv("AWS_REGION"), "region")
 	rootCmd.Flags().StringVar(&key, "key", os.Getenv("AWS_ACCESS_KEY_ID"), "access key")
 	rootCmd.Flags().StringVar(&secret, "secret", os.Getenv("AWS_SECRET_ACCESS_KEY"), "secret access key")
+	rootCmd.Flags().StringVar(&profile, "profile", os.Getenv("AWS_PROFILE"), "shared config/credentials profile to use, if --key is not set")
 	rootCmd.Flags().StringVar(&rolearn, "rolearn", os.Getenv("ROLE_ARN"), "if set, the role to assume using the provided key/secret")
 	rootCmd.Flags().StringSliceVar(&pk, "pk", pk, "primary key to query, format: [key:value] (if empty, scan is implied)")
-	rootCmd.Flags().StringSliceVar(&sk, "sk", sk, "sort key if any, format: [key:value] (begins_with will be used if not empty)")
-	rootCmd.Flags().StringSliceVar(&incols, "attr", incols, "attributes (columns) to include")
+	rootCmd.Flags().StringSliceVar(&sk, "sk", sk, "sort key if any, format: [key:value] (begins_with will be used if not empty), the i'th goes with the i'th --pk (all go with a single --pk), use ';' for several under the same --pk, i.e. 'ts:2024-01;ts:2024-02'")
+	rootCmd.Flags().StringSliceVar(&incols, "attr", incols, "attributes (columns) to include, displayed in the order given; nested paths like 'a.b,c[0].d' are allowed")
 	rootCmd.Flags().StringSliceVar(&contains, "contains", contains, "filter output, '^' means exclude, fmt: <col-index:[[^]regex:]expr>, i.e. '1:^regex:my.*'")
 	rootCmd.Flags().BoolVar(&describe, "describe", describe, "if set, describe the table only")
-	rootCmd.Flags().Int64Var(&limit, "limit", limit, "max number of output for query/scan")
+	rootCmd.Flags().Int64Var(&limit, "limit", limit, "max number of items fetched by the query (in total, across all the --pk) or scan, 0 means all")
+	rootCmd.Flags().Int64Var(&keylimit, "limit-per-key", keylimit, "max number of items fetched per --pk (or --pk/--sk pair), along with --limit, 0 means all")
+	rootCmd.Flags().Int64Var(&pagesize, "page-size", pagesize, "max items per Query/Scan request (the Limit sent), independent of --limit, 0 means up to --limit (or 1 MB); smaller pages smooth the capacity spikes, larger ones save round trips")
+	rootCmd.Flags().Int64Var(&skip, "skip", skip, "discard the first N matching rows (after --top, --sort-by), fetching that many more with --limit, i.e. to page through the results in scripts")
+	rootCmd.Flags().BoolVar(&explain, "explain", explain, "if set, print the Query/Scan requests (key condition, filter, projection, index, page size) to stderr before sending them")
+	rootCmd.Flags().Float64Var(&scanwarn, "scan-warn-rcu", 1000, "warn before a scan estimated (from the table's size) to consume at least this many RCUs")
+	rootCmd.Flags().Float64Var(&scanmax, "scan-max-rcu", 100000, "refuse a scan estimated to consume at least this many RCUs, unless --force is set, 0 means no limit")
+	rootCmd.Flags().BoolVar(&force, "force", force, "if set, run scans over --scan-max-rcu")
+	rootCmd.Flags().StringVar(&skbetw, "sk-between", skbetw, "sort key range of all the --pk, inclusive, format: [key:low:high], i.e. 'ts:2024-01-01:2024-02-01' (the values can contain ':' if both have as many, as timestamps)")
+	rootCmd.Flags().BoolVar(&transact, "transact", transact, "if set, fetch the items with the --pk/--sk keys (exact, up to 100) in a single TransactGetItems, i.e. all as of the same point in time")
+	rootCmd.Flags().StringVar(&index, "index", index, "query (or scan) this secondary index instead of the table, --pk/--sk being the index's keys (if empty, and --pk/--sk are not the table's keys, the index keyed by them is queried)")
+	rootCmd.Flags().StringArrayVar(&filters, "filter", filters, "server-side filter (all must match), fmt: <attr><op><value>, op: =, !=, <, <=, >, >=, ^= (begins with), ~= (contains), i.e. 'status!=done', 'retries>=3'")
 	rootCmd.Flags().BoolVar(&nosort, "nosort", nosort, "if set, don't sort the attributes")
 	rootCmd.Flags().BoolVar(&noborder, "noborder", noborder, "if set, remove table borders")
 	rootCmd.Flags().BoolVar(&del, "delete", del, "if set, delete the items that are queried")
-	rootCmd.Flags().StringVar(&csvf, "csv", csvf, "if provided, output to csv with value as filename")
-	rootCmd.Flags().IntVar(&maxlen, "maxlen", tablewriter.MAX_ROW_WIDTH, "max len of each cell")
-	rootCmd.Flags().StringSliceVar(&b64dec, "decb64", b64dec, "decode base64-encoded sections, fmt: <col-index[:sep:split-index]>, i.e. '1', '1:|:3'")
-	rootCmd.Execute()
+	rootCmd.Flags().StringVar(&retvals, "return-values", retvals, "with --delete, write the deleted items (ReturnValues ALL_OLD, as stored) as dynamodb json lines to this file, '-' (or no value) means stdout")
+	rootCmd.Flags().Lookup("return-values").NoOptDefVal = "-"
+	rootCmd.Flags().StringVar(&auditlog, "audit-log", auditlog, "append the runs that change (or delete) items (who, when, table, item count, flags) to this file, instead of $XDG_STATE_HOME/lsdy/audit")
+	rootCmd.Flags().StringVar(&auditcwl, "audit-cloudwatch", auditcwl, "also send the audit log lines to this cloudwatch logs group, fmt: <group[:stream]> (stream 'lsdy' if not set), i.e. '/ops/lsdy'")
+	rootCmd.Flags().StringVar(&outtmpl, "template", outtmpl, "if set, write the items with this go template instead of the table, or '@name' for the name.tmpl file in --templates-dir, i.e. '{{range .Items}}{{.id}} {{.status}}{{\"\\n\"}}{{end}}', '@incident-report'")
+	rootCmd.Flags().StringVar(&tmpldir, "templates-dir", tmpldir, "the directory of the '--template @name' templates, i.e. a shared one, set in the config file (default $XDG_CONFIG_HOME/lsdy/templates)")
+	rootCmd.Flags().BoolVar(&rownum, "rownum", rownum, "if set, prefix each row (and csv line) with its number, after filtering, as used by --detail")
+	rootCmd.Flags().StringVar(&pipecmd, "pipe", pipecmd, "if set, pipe the output (table, or --csv -, ...) through this shell command, i.e. 'less -S', 'column -s, -t'")
+	rootCmd.Flags().BoolVar(&nopager, "no-pager", nopager, "if set, don't page the output taller than the terminal through $PAGER")
+	rootCmd.Flags().StringVar(&csvf, "csv", csvf, "if provided, output to csv with value as filename, '-' means stdout (implies --quiet)")
+	rootCmd.Flags().StringSliceVar(&csvhdr, "csv-header", csvhdr, "the csv columns, and their header labels, in order, fmt: <attr[=label],...>, i.e. 'id,created_at=created,status' (all the columns, as displayed, if not set)")
+	rootCmd.Flags().BoolVar(&csvapnd, "csv-append", csvapnd, "if set, append the rows to the --csv file instead of replacing it, with the header only if the file is new (or empty), i.e. to accumulate --watch runs")
+	rootCmd.Flags().BoolVar(&csvstrct, "csv-strict", csvstrct, "if set, write the csv as in rfc 4180: whole values (not truncated to --maxlen), double quotes escaped instead of replaced, empty cells for missing attributes, and crlf line endings")
+	rootCmd.Flags().StringVar(&maxlen, "maxlen", strconv.Itoa(tablewriter.MAX_ROW_WIDTH), "max len of each cell, or per column, fmt: <n|attr=n[,attr=n...][,*=n]>, i.e. 'payload=40,id=36,*=20'")
+	rootCmd.Flags().StringSliceVar(&b64dec, "decb64", b64dec, "decode base64-encoded sections, add ':gz', ':zstd', or ':snappy' to decompress after decoding, fmt: <col-index|attr[:sep:split-index][:gz|zstd|snappy]>, i.e. '1', 'payload:|:3', '1:gz'")
+	rootCmd.Flags().StringVar(&top, "top", top, "keep only the N rows with the highest value of an attribute, fmt: <N:by=attr>, i.e. '20:by=latency'")
+	rootCmd.Flags().StringVar(&bottom, "bottom", bottom, "keep only the N rows with the lowest value of an attribute, fmt: <N:by=attr>")
+	rootCmd.Flags().StringSliceVar(&sortby, "sort-by", sortby, "sort the output rows by attribute values (numeric-aware), in order, fmt: <attr[:desc]>, i.e. 'region,created_at:desc'")
+	rootCmd.Flags().StringSliceVar(&dedupe, "dedupe", dedupe, "if set, drop duplicate rows, compared on all columns, or only the named ones, i.e. '--dedupe=id,ts'")
+	rootCmd.Flags().Lookup("dedupe").NoOptDefVal = "*"
+	rootCmd.Flags().StringSliceVar(&rename, "rename", rename, "rename column headers in the output, fmt: <attr=name>, i.e. 'verylongattributename=name'")
+	rootCmd.Flags().StringSliceVar(&colorder, "column-order", colorder, "columns to display first, in order, the rest follow; '@keys' means the table's key columns")
+	rootCmd.Flags().BoolVar(&flat, "flatten", flat, "if set, expand map attributes into 'parent.child' columns")
+	rootCmd.Flags().IntVar(&flatlvl, "flatten-depth", flatlvl, "max nesting level to expand with --flatten, 0 means no limit")
+	rootCmd.Flags().StringVar(&explattr, "explode", explattr, "emit one row per element of this list attribute, repeating the other columns")
+	rootCmd.Flags().StringArrayVar(&xforms, "transform", xforms, "transform attribute values through a pipeline of named transforms (applied left to right), fmt: <attr:name[:arg...][|name...]>, i.e. 'payload:b64|gz|json.path(.data)', 'created_at:ts:ms:Asia/Tokyo'")
+	rootCmd.Flags().StringVar(&setsep, "set-sep", setsep, "if set, join set (SS/NS/BS) elements with this separator instead of rendering as JSON arrays")
+	rootCmd.Flags().StringVar(&binmode, "binary", "base64", "how to display binary (B) attributes: base64, hex, hexdump, size")
+	rootCmd.Flags().StringSliceVar(&protos, "proto", protos, "decode base64 protobuf attributes to json, fmt: <attr:descriptor-set-file:package.Message>")
+	rootCmd.Flags().StringArrayVar(&execs, "transform-exec", execs, "pipe attribute values through an external command (one value per line in, one per line out), applied before --transform, fmt: <attr:command>")
+	rootCmd.Flags().IntVar(&execbat, "transform-exec-batch", 1000, "number of values sent per --transform-exec command invocation, 0 means all at once")
+	rootCmd.Flags().StringVar(&scriptf, "script", scriptf, "starlark file defining 'transform(item)' that returns the modified item, or None to drop it")
+	rootCmd.Flags().StringSliceVar(&masks, "mask", masks, "mask attribute values in all outputs, optionally keeping a number of leading/trailing characters, fmt: <attr[:prefix[:suffix]]>, i.e. 'email', 'card:0:4'")
+	rootCmd.Flags().StringArrayVar(&hashf, "hash", hashf, "replace attribute values with their (keyed, if salt is set) hash in all outputs, fmt: <attr:md5|sha1|sha256|sha512[:salt]>")
+	rootCmd.Flags().IntSliceVar(&details, "detail", details, "print the full item of these output rows (1-based) as json after the table")
+	rootCmd.Flags().BoolVar(&fit, "fit", fit, "if set, fit the table to the terminal width by shrinking the widest columns first")
+	rootCmd.Flags().BoolVar(&wrap, "wrap", wrap, "if set, wrap long cells across lines within the column width instead of truncating them")
+	rootCmd.Flags().StringVar(&colorf, "color", "auto", "colorize the table output: auto (if stdout is a terminal), always, never")
+	rootCmd.Flags().BoolVar(&nocolor, "no-color", nocolor, "if set, disable colors (same as NO_COLOR env)")
+	rootCmd.Flags().BoolVar(&zebra, "zebra", zebra, "if set, shade alternating rows (with colors enabled)")
+	rootCmd.Flags().StringArrayVar(&colrules, "color-rule", colrules, "color rows whose attribute matches a regex, fmt: <attr:regex:color[+color]>, i.e. 'status:(?i)fail:red+bold'")
+	rootCmd.Flags().BoolVar(&vert, "vertical", vert, "if set, print each item as a block of 'attribute: value' lines instead of a table (like mysql's \\G)")
+	rootCmd.Flags().BoolVar(&transp, "transpose", transp, "if set, display attributes as rows and items as columns, i.e. to compare a few items side by side")
+	rootCmd.Flags().BoolVar(&keysonly, "keys-only", keysonly, "if set, only fetch the key attributes of the table, and print them one item per line, tab-separated, in the --pk/--sk format, i.e. 'id:ID0001<tab>ts:2024-01-02'")
+	rootCmd.Flags().BoolVar(&quiet, "quiet", quiet, "if set, don't print the table or informational messages, only the structured outputs (--csv, --detail)")
+	rootCmd.Flags().StringVar(&expiring, "expiring", expiring, "if set, only fetch the items that the table's ttl expires within this window, i.e. '36h', '7d' (including the ones expired, pending deletion), and log their count by day")
+	rootCmd.Flags().StringVar(&validate, "validate", validate, "if set, check the fetched items (as stored) against this json schema file, reporting the violations by key, and exit with a non-zero status if any item is invalid")
+	rootCmd.Flags().BoolVar(&failemp, "fail-empty", failemp, "if set, exit with a non-zero status when no rows match")
+	rootCmd.Flags().StringVar(&summary, "summary", summary, "if set, write a json summary of the run (items fetched, and scanned, rows, pages, consumed rcu, throttles, retries, elapsed, deleted) to this file, '-' means stderr")
+	rootCmd.Flags().Lookup("summary").NoOptDefVal = "-"
+	rootCmd.Flags().CountVarP(&verbose, "verbose", "v", "log the dynamodb api calls (pages, item counts, latencies) to stderr, -vv to include the request parameters")
+	rootCmd.Flags().StringVar(&otlp, "otlp", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "if set, export traces of the run and its dynamodb api calls to this otlp/http endpoint, i.e. 'http://localhost:4318'")
+	rootCmd.Flags().StringVar(&proxy, "proxy", proxy, "http(s) proxy url for the aws calls, i.e. 'http://proxy:3128' (if empty, HTTPS_PROXY is used)")
+	rootCmd.Flags().StringVar(&cabundle, "ca-bundle", os.Getenv("AWS_CA_BUNDLE"), "pem file with additional CA certificates to trust, i.e. for tls-intercepting proxies")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", timeout, "if set, stop fetching after this duration, i.e. '30s', and display the items fetched so far (same as Ctrl-C)")
+	rootCmd.Flags().BoolVar(&fips, "fips", fips, "if set, use the region's FIPS endpoint, i.e. for GovCloud")
+	rootCmd.Flags().BoolVar(&dualstk, "dualstack", dualstk, "if set, use the region's dualstack (IPv4/IPv6) endpoint")
+	rootCmd.Flags().StringVar(&cfgfile, "config", configPath(), "yaml file with default flag values (flag name to value, or list of values), flags in the command line take precedence")
+	rootCmd.Flags().BoolVar(&nohist, "no-history", nohist, "if set, don't record this invocation in the history (see 'lsdy history')")
+	rootCmd.Flags().StringVar(&envname, "env", envname, "apply the flag values (and table_prefix) of this environment, as defined under 'envs' in the config file")
+	rootCmd.Flags().DurationVar(&watch, "watch", watch, "if set, run the query at this interval, i.e. '10s', marking the new (+), changed (~), and removed (-) rows, until Ctrl-C")
+	rootCmd.Flags().DurationVar(&cachettl, "cache", cachettl, "if set, store the fetched items on disk, and reuse them while newer than this, i.e. '1h' (the display flags can change)")
+	rootCmd.Flags().BoolVar(&offline, "offline", offline, "if set, use the items stored by --cache regardless of their age, without calling aws")
+	rootCmd.Flags().MarkDeprecated("decb64", "use --transform instead, i.e. '<attr>:b64', '<attr>:seg(|,3)|b64'")
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	historyCmd.Flags().IntVar(&histlast, "last", 20, "number of entries to list, 0 means all")
+	tailCmd.Flags().StringVar(&tailfrom, "from", tailfrom, "if set, start from this time (RFC3339), or this long ago, i.e. '30m', instead of the new changes only (the stream keeps 24 hours)")
+	tailCmd.Flags().StringVar(&tailuntl, "until", tailuntl, "if set, stop once the stream is read up to this time (RFC3339), or this long ago")
+	tailCmd.Flags().StringVar(&tailout, "out", tailout, "if set, append the change records to this file as json lines instead of displaying them, '-' means stdout")
+	tailCmd.Flags().BoolVar(&tailkin, "kinesis", tailkin, "if set, read the changes from the table's kinesis data stream destination, even if its dynamodb stream is enabled")
+	tailCmd.Flags().StringVar(&tailefo, "efo", tailefo, "if set, read the kinesis data stream with enhanced fan-out through this consumer (registered if needed, and deregistered on exit), implies --kinesis")
+	snapshotCmd.Flags().StringVar(&snaptag, "tag", snaptag, "name to store the snapshot under, i.e. 'before'")
+	daemonCmd.Flags().DurationVar(&dmevery, "every", dmevery, "interval between runs, i.e. '5m'")
+	daemonCmd.Flags().StringVar(&dmquery, "query", dmquery, "name of the saved query to run (see 'lsdy save')")
+	daemonCmd.Flags().StringVar(&dmout, "out", dmout, "file to append the rows to (default '<query>.ndjson')")
+	daemonCmd.Flags().BoolVar(&dmdiff, "diff", dmdiff, "if set, append only the rows that are new, changed, or removed since the previous run")
+	daemonCmd.Flags().IntVar(&dmrotmb, "rotate-mb", 100, "rotate the file when it reaches this size in MB, 0 means never")
+	daemonCmd.Flags().IntVar(&dmkeep, "rotate-keep", 5, "number of rotated files to keep")
+	serveCmd.Flags().IntVar(&svport, "port", 8080, "port to listen on")
+	serveCmd.Flags().StringVar(&svtoken, "token", svtoken, "if set, the bearer token required in the requests (default LSDY_TOKEN env)")
+	serveCmd.Flags().BoolVar(&svmetric, "metrics", svmetric, "if set, also export the results of the saved queries, and the size and consumed capacity of their tables, as Prometheus gauges at /metrics")
+	exportCmd.Flags().StringVar(&exout, "out", exout, "file to write the rows to, '-' means stdout")
+	exportCmd.Flags().StringVar(&exfmt, "format", exfmt, "output format, 'csv' or 'ndjson' (default csv if --out ends with '.csv', else ndjson)")
+	exportCmd.Flags().StringVar(&exres, "resume", exres, "if set, checkpoint the export to this file, and continue from it if it exists (see 'lsdy export -h')")
+	updateCmd.Flags().BoolVar(&updchk, "check", updchk, "if set, only report whether a newer release exists")
+	ddlCmd.Flags().StringVar(&ddlfmt, "format", "athena", "output format, 'athena' (CREATE EXTERNAL TABLE) or 'glue' (TableInput json)")
+	ddlCmd.Flags().StringVar(&ddlloc, "location", "s3://BUCKET/PREFIX/AWSDynamoDB/EXPORT_ID/data/", "s3 location of the exported data")
+	ddlCmd.Flags().StringVar(&ddlname, "name", ddlname, "name of the athena/glue table (default the table name, lowercased, with '_' for other characters)")
+	ddlCmd.Flags().Int64Var(&sample, "sample", 1000, "number of items to infer the schema from")
+	workbenchCmd.Flags().Int64Var(&wbsample, "sample", 25, "number of items to include as the table data")
+	workbenchCmd.Flags().StringVar(&wbname, "name", wbname, "name of the data model (default the table name)")
+	iacCmd.Flags().StringVar(&iacfmt, "format", "terraform", "output format, 'terraform' or 'cfn' (cloudformation)")
+	checkRefsCmd.Flags().StringVar(&reffrom, "from", reffrom, "the referencing attribute, fmt: <table.attr>, i.e. 'orders.customer_id'")
+	checkRefsCmd.Flags().StringVar(&refto, "to", refto, "the referenced attribute, fmt: <table.attr>, i.e. 'customers.pk'")
+	replLagCmd.Flags().StringSliceVar(&canary, "canary", canary, "key of the canary item, fmt: <attr:value>, repeat (or comma-separate) for the sort key, i.e. 'pk:_lsdy_canary'")
+	replLagCmd.Flags().DurationVar(&lagwait, "wait", time.Minute, "max time to wait for the write to show up in each region")
+	replLagCmd.Flags().DurationVar(&lagevery, "every", 100*time.Millisecond, "interval between the reads of each region")
+	insightsCmd.Flags().BoolVar(&cienable, "enable", cienable, "if set, enable contributor insights for the table (or --index), and exit")
+	insightsCmd.Flags().BoolVar(&cidisabl, "disable", cidisabl, "if set, disable contributor insights for the table (or --index), and exit")
+	insightsCmd.Flags().DurationVar(&cisince, "since", time.Hour, "time range of the report, up to now")
+	insightsCmd.Flags().Int64Var(&cikeys, "keys", 10, "number of keys to print per rule")
+	hotkeysCmd.Flags().Int64Var(&hksample, "sample", 100000, "number of items to sample the key distribution from, 0 means all")
+	hotkeysCmd.Flags().DurationVar(&hksince, "since", time.Hour, "time range of the cloudwatch metrics, up to now")
+	hotkeysCmd.Flags().IntVar(&hkkeys, "keys", 10, "number of partition keys to print")
+	costCmd.Flags().DurationVar(&costsnce, "since", 7*24*time.Hour, "time range of the consumed capacity to extrapolate, 1h to 60 days")
+	costCmd.Flags().BoolVar(&costscan, "scan", costscan, "if set, add the cost of a full scan of the table")
+	costCmd.Flags().BoolVar(&costexp, "export", costexp, "if set, add the cost of an export of the table to s3")
+	costCmd.Flags().StringVar(&costprc, "prices", costprc, "prices to use instead of the us-east-1 ones (USD), fmt: <name=value[,name=value...]>, names: storage, storage-ia (per GB-month), rru, wru (per million), rcu, wcu (per hour), export (per GB)")
+	incCmd.Flags().Float64Var(&incby, "by", 1, "the number to add, negative to subtract")
+	incCmd.Flags().BoolVar(&incexist, "exists", incexist, "if set, fail (instead of creating it) if the item doesn't exist")
+	updateItemCmd.Flags().StringArrayVar(&lappend, "list-append", lappend, "append a value to a list attribute, fmt: <attr=value>, can be repeated")
+	updateItemCmd.Flags().StringArrayVar(&sdelete, "set-delete", sdelete, "remove a value from a string (or number) set attribute, fmt: <attr=value>, can be repeated")
+	updateItemCmd.Flags().BoolVar(&updexist, "exists", updexist, "if set, fail (instead of creating it) if the item doesn't exist")
+	createItemCmd.Flags().StringVar(&newitem, "item", newitem, "the item, a json object, i.e. '{\"plan\":\"free\"}', '-' means stdin")
+	importCmd.Flags().StringVar(&impfrom, "from", impfrom, "the csv file to import, with a header row of attribute names, '-' means stdin")
+	importCmd.Flags().BoolVar(&impupsert, "upsert", impupsert, "if set, only set the attributes of the columns in each item (UpdateItem), instead of replacing the items (PutItem)")
+	importCmd.Flags().StringSliceVar(&impkeys, "key-cols", impkeys, "the columns of the key attributes, in the order of the table's key (partition, then sort key), i.e. 'order_id,created', the key attribute names if not set")
+	rootCmd.AddCommand(saveCmd, runCmd, historyCmd, rerunCmd, shellCmd, tailCmd, snapshotCmd, diffSnapCmd, daemonCmd, serveCmd, exportCmd, completionCmd, updateCmd, versionCmd, ddlCmd, workbenchCmd, iacCmd, checkRefsCmd, replLagCmd, insightsCmd, hotkeysCmd, costCmd, incCmd, updateItemCmd, createItemCmd, importCmd)
+	registerCompletions()
+	checkUpdate()
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error { return usageError(err) })
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(exitCode(err))
+	}
 }
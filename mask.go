@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+)
+
+// parseMask parses a --mask value, fmt: <attr[:prefix[:suffix]]>, where prefix
+// and suffix are the number of characters to keep as is.
+func parseMask(v string) (*lsdy.Mask, error) {
+	sp := strings.Split(v, ":")
+	if sp[0] == "" || len(sp) > 3 {
+		return nil, usageErrorf("invalid --mask format: %v", v)
+	}
+
+	spec := &lsdy.Mask{Attr: sp[0]}
+	for i, p := range sp[1:] {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, usageErrorf("invalid --mask format: %v", v)
+		}
+
+		if i == 0 {
+			spec.Prefix = n
+		} else {
+			spec.Suffix = n
+		}
+	}
+
+	return spec, nil
+}
+
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// parseHash parses a --hash value, fmt: <attr:algo[:salt]>. When a salt is
+// provided, it is used as the HMAC key.
+func parseHash(v string) (*lsdy.Hash, error) {
+	sp := strings.SplitN(v, ":", 3)
+	if len(sp) < 2 || sp[0] == "" {
+		return nil, usageErrorf("invalid --hash format: %v", v)
+	}
+
+	fn, ok := hashes[sp[1]]
+	if !ok {
+		return nil, usageErrorf("unsupported --hash algorithm: %v", sp[1])
+	}
+
+	spec := &lsdy.Hash{Attr: sp[0], Algo: sp[1], New: fn}
+	if len(sp) == 3 {
+		spec.Salt = sp[2]
+	}
+
+	return spec, nil
+}
+
+// maskItem returns a copy of item with the --hash/--mask attributes replaced by
+// their hashed/masked values, as strings, same as in the table and exports.
+func maskItem(item map[string]*dynamodb.AttributeValue, p *lsdy.Pipeline) map[string]*dynamodb.AttributeValue {
+	out := make(map[string]*dynamodb.AttributeValue)
+	for k, av := range item {
+		if p.Hashes[k] == nil && p.Masks[k] == nil {
+			out[k] = av
+			continue
+		}
+
+		v, _ := lsdy.UnmarshalValue(av)
+		s, _ := p.Redact(k, fmtval(v))
+		out[k] = &dynamodb.AttributeValue{S: aws.String(s)}
+	}
+
+	return out
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+)
+
+func TestMaskItem(t *testing.T) {
+	mk, err := parseMask("email:2:4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs, err := parseHash("ssn:sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := map[string]*dynamodb.AttributeValue{
+		"id":    {S: aws.String("ID0001")},
+		"email": {S: aws.String("jdoe@example.com")},
+		"ssn":   {N: aws.String("123456789")},
+	}
+
+	var b bytes.Buffer
+	p := &lsdy.Pipeline{
+		Hashes: map[string]*lsdy.Hash{"ssn": hs},
+		Masks:  map[string]*lsdy.Mask{"email": mk},
+	}
+
+	old := maskItem(item, p)
+	if err := writeOld(&b, old); err != nil {
+		t.Fatal(err)
+	}
+
+	got := b.String()
+	for _, want := range []string{
+		`"id":{"S":"ID0001"}`,
+		`"email":{"S":"jd****.com"}`,
+		`"ssn":{"S":"` + hs.Apply("123456789") + `"}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %v, want %v in it", got, want)
+		}
+	}
+
+	if strings.Contains(got, "jdoe@") || strings.Contains(got, "123456789") {
+		t.Errorf("got %v, expecting no raw values", got)
+	}
+
+	if aws.StringValue(item["email"].S) != "jdoe@example.com" {
+		t.Error("expecting the item to be left as is")
+	}
+}
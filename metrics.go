@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// promMetrics are the gauges exported by 'lsdy serve --metrics', in order.
+var promMetrics = []struct{ name, help string }{
+	{"lsdy_query_up", "Whether the saved query ran successfully."},
+	{"lsdy_query_rows", "Rows of the saved query, after filters."},
+	{"lsdy_query_fetched_items", "Items fetched from dynamodb by the saved query."},
+	{"lsdy_query_consumed_rcu", "Read capacity units consumed by the saved query."},
+	{"lsdy_query_duration_seconds", "Time taken by the saved query."},
+	{"lsdy_table_items", "Item count of the table, updated by dynamodb about every six hours."},
+	{"lsdy_table_size_bytes", "Size of the table, updated by dynamodb about every six hours."},
+	{"lsdy_table_consumed_read_units", "Consumed read capacity units per second, in the latest minute reported to cloudwatch."},
+	{"lsdy_table_consumed_write_units", "Consumed write capacity units per second, in the latest minute reported to cloudwatch."},
+}
+
+var promLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promSamples collects samples by metric name, in the Prometheus text format.
+type promSamples map[string][]string
+
+// add adds a sample; labels are name, value pairs.
+func (p promSamples) add(metric string, v float64, labels ...string) {
+	var l []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		l = append(l, fmt.Sprintf(`%v="%v"`, labels[i], promLabel.Replace(labels[i+1])))
+	}
+
+	p[metric] = append(p[metric], fmt.Sprintf("%v{%v} %v", metric, strings.Join(l, ","),
+		strconv.FormatFloat(v, 'g', -1, 64)))
+}
+
+func (p promSamples) String() string {
+	var b strings.Builder
+	for _, m := range promMetrics {
+		if len(p[m.name]) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "# HELP %v %v\n# TYPE %v gauge\n", m.name, m.help, m.name)
+		for _, s := range p[m.name] {
+			b.WriteString(s + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// tableMetrics adds the lsdy_table_* samples of table, using the current
+// credentials/endpoint flags.
+func tableMetrics(p promSamples, table string) error {
+	svc, err := newService()
+	if err != nil {
+		return err
+	}
+
+	t, err := svc.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return err
+	}
+
+	p.add("lsdy_table_items", float64(aws.Int64Value(t.Table.ItemCount)), "region", region, "table", table)
+	p.add("lsdy_table_size_bytes", float64(aws.Int64Value(t.Table.TableSizeBytes)), "region", region, "table", table)
+
+	sess, cnfs, err := newSession()
+	if err != nil {
+		return err
+	}
+
+	cw := cloudwatch.New(sess, cnfs...)
+	for _, m := range []struct{ metric, cw string }{
+		{"lsdy_table_consumed_read_units", "ConsumedReadCapacityUnits"},
+		{"lsdy_table_consumed_write_units", "ConsumedWriteCapacityUnits"},
+	} {
+		now := time.Now()
+		out, err := cw.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("AWS/DynamoDB"),
+			MetricName: aws.String(m.cw),
+			Dimensions: []*cloudwatch.Dimension{{Name: aws.String("TableName"), Value: aws.String(table)}},
+			StartTime:  aws.Time(now.Add(-10 * time.Minute)),
+			EndTime:    aws.Time(now),
+			Period:     aws.Int64(60),
+			Statistics: []*string{aws.String(cloudwatch.StatisticSum)},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// No datapoints means no consumed capacity.
+		var latest *cloudwatch.Datapoint
+		for _, d := range out.Datapoints {
+			if latest == nil || d.Timestamp.After(*latest.Timestamp) {
+				latest = d
+			}
+		}
+
+		var v float64
+		if latest != nil {
+			v = aws.Float64Value(latest.Sum) / 60
+		}
+
+		p.add(m.metric, v, "region", region, "table", table)
+	}
+
+	return nil
+}
+
+// metrics runs all the saved queries, and exports their results (and their
+// tables') as Prometheus gauges, see serveCmd.
+func (s *server) metrics(w http.ResponseWriter, r *http.Request) {
+	names, err := queryNames()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := make(promSamples)
+	seen := make(map[string]bool) // region, table
+	for _, name := range names {
+		start := time.Now()
+		table, _, err := s.run(name)
+		if err == errRefused {
+			continue
+		}
+
+		if err != nil || lastrun == nil {
+			p.add("lsdy_query_up", 0, "query", name, "table", table)
+			continue
+		}
+
+		table = lastrun.table
+		p.add("lsdy_query_up", 1, "query", name, "table", table)
+		p.add("lsdy_query_rows", float64(lastrun.Rows), "query", name, "table", table)
+		p.add("lsdy_query_fetched_items", float64(lastrun.Fetched), "query", name, "table", table)
+		p.add("lsdy_query_consumed_rcu", lastrun.RCU, "query", name, "table", table)
+		p.add("lsdy_query_duration_seconds", time.Since(start).Seconds(), "query", name, "table", table)
+
+		k := region + "/" + table
+		if seen[k] {
+			continue
+		}
+
+		seen[k] = true
+		if err := tableMetrics(p, table); err != nil {
+			log.Printf("table %v: %v\n", table, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, p)
+}
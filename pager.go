@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"golang.org/x/term"
+)
+
+// output is where run writes its results: stdout, the stdin of the --pipe
+// command, or a buffer, written through $PAGER if taller than the terminal.
+type output struct {
+	io.Writer
+	buf *bytes.Buffer  // paged, if set
+	in  io.WriteCloser // of the --pipe command
+	cmd *exec.Cmd
+}
+
+// newOutput starts the --pipe command, if set. Otherwise, if page is true, and
+// $PAGER is set, the output is buffered when stdout is a terminal.
+func newOutput(page bool) (*output, error) {
+	switch {
+	case pipecmd != "":
+		c := exec.Command("sh", "-c", pipecmd)
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		in, err := c.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.Start(); err != nil {
+			return nil, fmt.Errorf("pipe [%v]: %v", pipecmd, err)
+		}
+
+		return &output{Writer: in, in: in, cmd: c}, nil
+	case page && !nopager && os.Getenv("PAGER") != "" && term.IsTerminal(int(os.Stdout.Fd())):
+		var b bytes.Buffer
+		return &output{Writer: &b, buf: &b}, nil
+	}
+
+	return &output{Writer: os.Stdout}, nil
+}
+
+// close waits for the --pipe command to finish, or writes the buffered output,
+// through $PAGER if it has more lines than the terminal. Only the first call
+// does, the others return nil.
+func (o *output) close() error {
+	defer func() { o.Writer, o.buf, o.cmd = io.Discard, nil, nil }()
+	switch {
+	case o.cmd != nil:
+		o.in.Close()
+		if err := o.cmd.Wait(); err != nil {
+			return fmt.Errorf("pipe [%v]: %v", pipecmd, err)
+		}
+	case o.buf != nil:
+		_, h, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil || bytes.Count(o.buf.Bytes(), []byte("\n")) < h {
+			_, err := o.buf.WriteTo(os.Stdout)
+			return err
+		}
+
+		c := exec.Command("sh", "-c", os.Getenv("PAGER"))
+		c.Stdin = o.buf
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		c.Env = os.Environ()
+		if os.Getenv("LESS") == "" {
+			c.Env = append(c.Env, "LESS=FRX") // keep the colors, as git does
+		}
+
+		if err := c.Run(); err != nil {
+			return fmt.Errorf("pager [%v]: %v", os.Getenv("PAGER"), err)
+		}
+	}
+
+	return nil
+}
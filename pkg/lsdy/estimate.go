@@ -0,0 +1,62 @@
+package lsdy
+
+import (
+	"math"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ScanEstimate is the expected cost of a Scan, from the (approximate, updated by
+// dynamodb about every six hours) size and item count of the table or index.
+type ScanEstimate struct {
+	Items int64
+	Bytes int64
+	Pages int64
+	RCU   float64 // eventually consistent reads, 4 KB per half unit
+}
+
+// EstimateScan returns the expected cost of s against t. ok is false if t has no
+// size information yet, or if s.Index is not one of its indexes.
+func EstimateScan(t *dynamodb.TableDescription, s *Scan) (e ScanEstimate, ok bool) {
+	count, size := aws.Int64Value(t.ItemCount), aws.Int64Value(t.TableSizeBytes)
+	if s.Index != "" {
+		found := false
+		for _, v := range t.GlobalSecondaryIndexes {
+			if aws.StringValue(v.IndexName) == s.Index {
+				count, size, found = aws.Int64Value(v.ItemCount), aws.Int64Value(v.IndexSizeBytes), true
+			}
+		}
+
+		for _, v := range t.LocalSecondaryIndexes {
+			if aws.StringValue(v.IndexName) == s.Index {
+				count, size, found = aws.Int64Value(v.ItemCount), aws.Int64Value(v.IndexSizeBytes), true
+			}
+		}
+
+		if !found {
+			return e, false
+		}
+	}
+
+	if count == 0 || size == 0 {
+		return e, false
+	}
+
+	e.Items, e.Bytes = count, size
+	if s.Limit > 0 && s.Limit < count {
+		e.Items = s.Limit
+		e.Bytes = size / count * s.Limit
+	}
+
+	const mb = 1 << 20
+	e.Pages = int64(math.Ceil(float64(e.Bytes) / mb))
+	if size := pageLimit(s.Limit, s.PageSize); size > 0 {
+		if n := int64(math.Ceil(float64(e.Items) / float64(size))); n > e.Pages {
+			e.Pages = n
+		}
+	}
+
+	e.RCU = math.Ceil(float64(e.Bytes)/4096) / 2
+	return e, true
+}
@@ -0,0 +1,288 @@
+package lsdy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// UnmarshalItems unmarshals the items of a page, as dynamodbattribute does, except
+// that numbers (N) are kept as json.Number, with the digits as stored, so that the
+// ones beyond 2^53 are displayed, and written exactly. Number sets (NS) are still
+// []float64.
+func UnmarshalItems(items []map[string]*dynamodb.AttributeValue) ([]map[string]interface{}, error) {
+	var out []map[string]interface{}
+	for _, item := range items {
+		m := make(map[string]interface{})
+		for k, av := range item {
+			v, err := UnmarshalValue(av)
+			if err != nil {
+				return nil, err
+			}
+
+			m[k] = v
+		}
+
+		out = append(out, m)
+	}
+
+	return out, nil
+}
+
+// UnmarshalValue unmarshals an attribute value, with the numbers as UnmarshalItems.
+func UnmarshalValue(av *dynamodb.AttributeValue) (interface{}, error) {
+	var v interface{}
+	d := dynamodbattribute.NewDecoder(func(d *dynamodbattribute.Decoder) { d.UseNumber = true })
+	if err := d.Decode(av, &v); err != nil {
+		return nil, err
+	}
+
+	return numbers(v), nil
+}
+
+// numbers replaces the dynamodbattribute numbers in v, at any depth.
+func numbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case dynamodbattribute.Number:
+		return json.Number(t)
+	case []dynamodbattribute.Number:
+		var out []float64
+		for _, n := range t {
+			f, _ := strconv.ParseFloat(string(n), 64)
+			out = append(out, f)
+		}
+
+		return out
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = numbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = numbers(e)
+		}
+	}
+
+	return v
+}
+
+// Flatten expands nested map attributes into 'parent.child' attributes, up to
+// depth levels (0 means no limit). Maps below the depth limit are kept as is.
+func Flatten(item map[string]interface{}, depth int) map[string]interface{} {
+	out := make(map[string]interface{})
+	var walk func(prefix string, v map[string]interface{}, level int)
+	walk = func(prefix string, v map[string]interface{}, level int) {
+		for k, val := range v {
+			name := k
+			if prefix != "" {
+				name = prefix + "." + k
+			}
+
+			if mm, ok := val.(map[string]interface{}); ok && len(mm) > 0 {
+				if depth == 0 || level < depth {
+					walk(name, mm, level+1)
+					continue
+				}
+			}
+
+			out[name] = val
+		}
+	}
+
+	walk("", item, 0)
+	return out
+}
+
+// LookupPath resolves an attribute path, i.e. 'config.timeout', 'items[0].sku',
+// against an unmarshaled item.
+func LookupPath(item map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = item
+	for _, seg := range strings.Split(path, ".") {
+		name := seg
+		var idxs []int
+		if i := strings.Index(seg, "["); i >= 0 {
+			name = seg[:i]
+			rest := seg[i:]
+			for rest != "" {
+				if rest[0] != '[' {
+					return nil, false
+				}
+
+				j := strings.Index(rest, "]")
+				if j < 0 {
+					return nil, false
+				}
+
+				n, err := strconv.Atoi(rest[1:j])
+				if err != nil {
+					return nil, false
+				}
+
+				idxs = append(idxs, n)
+				rest = rest[j+1:]
+			}
+		}
+
+		if name != "" {
+			mm, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+
+			if cur, ok = mm[name]; !ok {
+				return nil, false
+			}
+		}
+
+		for _, n := range idxs {
+			l, ok := cur.([]interface{})
+			if !ok || n < 0 || n >= len(l) {
+				return nil, false
+			}
+
+			cur = l[n]
+		}
+	}
+
+	return cur, true
+}
+
+// IsPath returns true if attr looks like a nested attribute path.
+func IsPath(attr string) bool { return strings.ContainsAny(attr, ".[") }
+
+// Explode returns one item per element of the list (or set) attribute attr, with
+// the other attributes repeated. Items where attr is not a list are returned as is.
+func Explode(item map[string]interface{}, attr string) []map[string]interface{} {
+	var elems []interface{}
+	switch t := item[attr].(type) {
+	case []interface{}:
+		elems = t
+	case []string:
+		for _, v := range t {
+			elems = append(elems, v)
+		}
+	case []float64:
+		for _, v := range t {
+			elems = append(elems, v)
+		}
+	default:
+		return []map[string]interface{}{item}
+	}
+
+	if len(elems) == 0 {
+		cp := make(map[string]interface{})
+		for k, v := range item {
+			if k != attr {
+				cp[k] = v
+			}
+		}
+
+		return []map[string]interface{}{cp}
+	}
+
+	var out []map[string]interface{}
+	for _, e := range elems {
+		cp := make(map[string]interface{})
+		for k, v := range item {
+			cp[k] = v
+		}
+
+		cp[attr] = e
+		out = append(out, cp)
+	}
+
+	return out
+}
+
+// Format holds the display options of attribute values.
+type Format struct {
+	SetSep string // if set, set elements are joined using this, instead of json
+	Binary string // binary values as 'base64' (default), 'hex', 'hexdump', or 'size'
+}
+
+// Value returns the display string of an unmarshaled attribute value. Maps (M),
+// lists (L), and sets (SS, NS, BS) are rendered as JSON, unless SetSep is set, in
+// which case set elements are joined using that separator instead.
+func (f Format) Value(v interface{}) string {
+	switch t := v.(type) {
+	case []byte:
+		return f.binary(t)
+	case []string, []float64, [][]byte:
+		if f.SetSep != "" {
+			return f.joinset(t)
+		}
+
+		if s, err := JSON(v); err == nil {
+			return s
+		}
+	case map[string]interface{}, []interface{}:
+		if s, err := JSON(v); err == nil {
+			return s
+		}
+	case float64:
+		// Avoid the exponent format for large numbers, i.e. epoch timestamps.
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case json.Number:
+		return t.String()
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// JSON is json.Marshal without the HTML escaping.
+func JSON(v interface{}) (string, error) { return jsonenc(v, "") }
+
+// JSONIndent is json.MarshalIndent without the HTML escaping.
+func JSONIndent(v interface{}) (string, error) { return jsonenc(v, "  ") }
+
+func jsonenc(v interface{}, indent string) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// joinset joins the elements of a set attribute (SS, NS, BS) using SetSep.
+func (f Format) joinset(set interface{}) string {
+	var elems []string
+	switch t := set.(type) {
+	case []string:
+		elems = t
+	case []float64:
+		for _, v := range t {
+			elems = append(elems, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	case [][]byte:
+		for _, v := range t {
+			elems = append(elems, f.binary(v))
+		}
+	}
+
+	return strings.Join(elems, f.SetSep)
+}
+
+// binary returns the display string of a binary (B) value.
+func (f Format) binary(b []byte) string {
+	switch f.Binary {
+	case "hex":
+		return hex.EncodeToString(b)
+	case "hexdump":
+		return strings.TrimSuffix(hex.Dump(b), "\n")
+	case "size":
+		return fmt.Sprintf("(%d bytes)", len(b))
+	default:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+}
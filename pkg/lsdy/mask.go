@@ -0,0 +1,51 @@
+package lsdy
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"hash"
+	"unicode/utf8"
+)
+
+// Mask replaces the values of an attribute with '****', keeping Prefix and
+// Suffix characters as is.
+type Mask struct {
+	Attr   string
+	Prefix int
+	Suffix int
+}
+
+// Apply masks v, keeping the configured prefix/suffix characters. Values that are
+// too short to keep anything are masked completely.
+func (m *Mask) Apply(v string) string {
+	n := utf8.RuneCountInString(v)
+	if m.Prefix+m.Suffix >= n {
+		return "****"
+	}
+
+	r := []rune(v)
+	return string(r[:m.Prefix]) + "****" + string(r[n-m.Suffix:])
+}
+
+// Hash replaces the values of an attribute with their hex-encoded hash. When Salt
+// is set, it is used as the HMAC key.
+type Hash struct {
+	Attr string
+	Algo string
+	New  func() hash.Hash
+	Salt string
+}
+
+// Apply returns the hex-encoded (keyed, if salted) hash of v. The same input
+// always gives the same output, so hashed columns can still be joined.
+func (h *Hash) Apply(v string) string {
+	var hh hash.Hash
+	if h.Salt != "" {
+		hh = hmac.New(h.New, []byte(h.Salt))
+	} else {
+		hh = h.New()
+	}
+
+	hh.Write([]byte(v))
+	return hex.EncodeToString(hh.Sum(nil))
+}
@@ -0,0 +1,92 @@
+package lsdy
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// page is a Query/Scan response page.
+type page struct {
+	items   []map[string]*dynamodb.AttributeValue
+	lastKey map[string]*dynamodb.AttributeValue
+}
+
+// PageFunc receives the items of a page, and the LastEvaluatedKey after it (nil
+// for the last page), instead of them being accumulated, see Query.Page.
+type PageFunc func(items []map[string]*dynamodb.AttributeValue, lastKey map[string]*dynamodb.AttributeValue) error
+
+// paginate calls fetch with the LastEvaluatedKey of the previous page (nil for
+// the first one) until there are no more pages, or limit (if > 0) items. Each
+// page is retried while throttled. The items are returned, or passed to each if
+// set. On error, the items of the previous pages are returned along with it.
+func paginate(limit int64, each PageFunc, fetch func(start map[string]*dynamodb.AttributeValue) (page, error)) ([]map[string]*dynamodb.AttributeValue, error) {
+	items := []map[string]*dynamodb.AttributeValue{}
+	var start map[string]*dynamodb.AttributeValue
+	var n int64
+	for {
+		var p page
+		err := retry(func() error {
+			var err error
+			p, err = fetch(start)
+			return err
+		})
+
+		if err != nil {
+			return items, err
+		}
+
+		last := p.lastKey == nil
+		if limit > 0 && n+int64(len(p.items)) >= limit {
+			p.items, last = p.items[:limit-n], true
+		}
+
+		n += int64(len(p.items))
+		if each != nil {
+			lk := p.lastKey
+			if last {
+				lk = nil
+			}
+
+			if err := each(p.items, lk); err != nil {
+				return items, err
+			}
+		} else {
+			items = append(items, p.items...)
+		}
+
+		if last {
+			return items, nil
+		}
+
+		start = p.lastKey
+	}
+}
+
+// retry calls fn until it succeeds, or fails with an error other than a
+// throughput exceeded one, with exponential backoff, up to 15 minutes.
+func retry(fn func() error) error {
+	start := time.Now()
+	wait := 100 * time.Millisecond
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != dynamodb.ErrCodeProvisionedThroughputExceededException {
+			return err
+		}
+
+		if time.Since(start) > 15*time.Minute {
+			return err
+		}
+
+		time.Sleep(wait)
+		if wait < 5*time.Second {
+			wait *= 2
+		}
+	}
+}
@@ -0,0 +1,426 @@
+// Package lsdy is the querying and rendering core of the lsdy command, for other
+// tools to embed without shelling out to it.
+package lsdy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// Query fetches the items of one or more partition keys, from the table or one of
+// its secondary indexes, newest (highest sort key) first.
+type Query struct {
+	Table    string
+	Index    string   // if set, the secondary index to query
+	PK       []string // fmt: <attr:value>
+	SK       []string // optional, fmt: <attr:value> (begins_with), the i'th goes with the i'th PK
+	Between  string   // optional instead of SK, fmt: <attr:low:high> (between, inclusive), for all the PKs, see splitBetween
+	Limit    int64    // max items per partition key, 0 means all
+	Total    int64    // max items across all the partition keys, 0 means all
+	PageSize int64    // max items per request, 0 means up to Limit (or 1 MB)
+
+	Types      map[string]string // key attribute types (S, N, B), S if not set, see KeyTypes
+	Filter     *expression.ConditionBuilder
+	Projection []string
+	Ascending  bool
+	Start      map[string]*dynamodb.AttributeValue // exclusive start key of the first partition key
+
+	// Begin, if set, is called before the items of each partition key are
+	// fetched, i.e. to track progress.
+	Begin func(pk string)
+
+	// Page, if set, receives each page of items, which Run then doesn't return,
+	// i.e. to export more items than fit in memory.
+	Page PageFunc
+}
+
+// Inputs returns the Query inputs, one per partition key, as sent by Run (without
+// the ExclusiveStartKey of the following pages, and with Total, the Limit of the
+// partition keys after the first one can be lower).
+func (q *Query) Inputs() ([]*dynamodb.QueryInput, error) {
+	var ins []*dynamodb.QueryInput
+	for i, v := range q.PK {
+		k, pv, err := splitKey("pk", v)
+		if err != nil {
+			return nil, err
+		}
+
+		av, err := KeyValue(q.Types[k], pv)
+		if err != nil {
+			return nil, err
+		}
+
+		kc := expression.Key(k).Equal(expression.Value(av))
+		switch {
+		case q.Between != "":
+			sk, low, high, err := splitBetween(q.Between)
+			if err != nil {
+				return nil, err
+			}
+
+			lv, err := KeyValue(q.Types[sk], low)
+			if err != nil {
+				return nil, err
+			}
+
+			hv, err := KeyValue(q.Types[sk], high)
+			if err != nil {
+				return nil, err
+			}
+
+			kc = kc.And(expression.Key(sk).Between(expression.Value(lv), expression.Value(hv)))
+		case i < len(q.SK) && q.SK[i] != "":
+			sk, sv, err := splitKey("sk", q.SK[i])
+			if err != nil {
+				return nil, err
+			}
+
+			kc = kc.And(expression.Key(sk).BeginsWith(sv))
+		}
+
+		b := expression.NewBuilder().WithKeyCondition(kc)
+		b = withFilter(b, q.Filter, q.Projection)
+		expr, err := b.Build()
+		if err != nil {
+			return nil, err
+		}
+
+		in := &dynamodb.QueryInput{
+			TableName:                 aws.String(q.Table),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ProjectionExpression:      expr.Projection(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ScanIndexForward:          aws.Bool(q.Ascending),
+		}
+
+		if q.Index != "" {
+			in.IndexName = aws.String(q.Index)
+		}
+
+		if n := pageLimit(q.keyLimit(0), q.PageSize); n > 0 {
+			in.Limit = aws.Int64(n)
+		}
+
+		if i == 0 && q.Start != nil {
+			in.ExclusiveStartKey = q.Start
+		}
+
+		ins = append(ins, in)
+	}
+
+	return ins, nil
+}
+
+// Run returns the items of all the partition keys, in order. On error, the items
+// fetched so far are returned along with it.
+func (q *Query) Run(svc *dynamodb.DynamoDB) ([]map[string]*dynamodb.AttributeValue, error) {
+	ins, err := q.Inputs()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]*dynamodb.AttributeValue
+	var n int64 // items so far, for Total
+	each := q.Page
+	if each != nil {
+		each = func(page []map[string]*dynamodb.AttributeValue, lastKey map[string]*dynamodb.AttributeValue) error {
+			n += int64(len(page))
+			return q.Page(page, lastKey)
+		}
+	}
+
+	for i, in := range ins {
+		if q.Total > 0 && n >= q.Total {
+			break
+		}
+
+		if q.Begin != nil {
+			q.Begin(q.PK[i])
+		}
+
+		limit := q.keyLimit(n)
+		if size := pageLimit(limit, q.PageSize); size > 0 {
+			in.Limit = aws.Int64(size)
+		}
+
+		tmp, err := paginate(limit, each, func(start map[string]*dynamodb.AttributeValue) (page, error) {
+			if start != nil {
+				in.ExclusiveStartKey = start
+			}
+
+			out, err := svc.Query(in)
+			if err != nil {
+				return page{}, err
+			}
+
+			return page{out.Items, out.LastEvaluatedKey}, nil
+		})
+
+		n += int64(len(tmp))
+		items = append(items, tmp...)
+		if err != nil {
+			return items, fmt.Errorf("query failed: %w", err)
+		}
+	}
+
+	return items, nil
+}
+
+// keyLimit returns the max items of the next partition key, after n items (of
+// the previous ones), from Limit and Total.
+func (q *Query) keyLimit(n int64) int64 {
+	limit := q.Limit
+	if q.Total > 0 && (limit == 0 || q.Total-n < limit) {
+		limit = q.Total - n
+	}
+
+	return limit
+}
+
+// Scan fetches the items of a table, or one of its secondary indexes.
+type Scan struct {
+	Table    string
+	Index    string // if set, the secondary index to scan
+	Limit    int64  // 0 means all
+	PageSize int64  // max items per request, 0 means up to Limit (or 1 MB)
+
+	Filter     *expression.ConditionBuilder
+	Projection []string
+	Start      map[string]*dynamodb.AttributeValue // exclusive start key
+	Page       PageFunc                            // see Query.Page
+}
+
+// Input returns the Scan input, as sent by Run (without the ExclusiveStartKey of
+// the following pages).
+func (s *Scan) Input() (*dynamodb.ScanInput, error) {
+	in := &dynamodb.ScanInput{TableName: aws.String(s.Table), ExclusiveStartKey: s.Start}
+	if s.Filter != nil || len(s.Projection) > 0 {
+		expr, err := withFilter(expression.NewBuilder(), s.Filter, s.Projection).Build()
+		if err != nil {
+			return nil, err
+		}
+
+		in.FilterExpression = expr.Filter()
+		in.ProjectionExpression = expr.Projection()
+		in.ExpressionAttributeNames = expr.Names()
+		in.ExpressionAttributeValues = expr.Values()
+	}
+
+	if s.Index != "" {
+		in.IndexName = aws.String(s.Index)
+	}
+
+	if n := pageLimit(s.Limit, s.PageSize); n > 0 {
+		in.Limit = aws.Int64(n)
+	}
+
+	return in, nil
+}
+
+// Run returns the scanned items. On error, the items fetched so far are returned
+// along with it.
+func (s *Scan) Run(svc *dynamodb.DynamoDB) ([]map[string]*dynamodb.AttributeValue, error) {
+	in, err := s.Input()
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := paginate(s.Limit, s.Page, func(start map[string]*dynamodb.AttributeValue) (page, error) {
+		if start != nil {
+			in.ExclusiveStartKey = start
+		}
+
+		out, err := svc.Scan(in)
+		if err != nil {
+			return page{}, err
+		}
+
+		return page{out.Items, out.LastEvaluatedKey}, nil
+	})
+
+	if err != nil {
+		return items, fmt.Errorf("scan failed: %w", err)
+	}
+
+	return items, nil
+}
+
+// MaxTransactGet is the max number of items of a TransactGet.
+const MaxTransactGet = 100
+
+// TransactGet fetches the items with keys from table in a single TransactGetItems,
+// i.e. all as of the same point in time, in the order of keys. The items that
+// don't exist are nil. proj, if set, are the attributes to return.
+func TransactGet(svc *dynamodb.DynamoDB, table string, keys []map[string]*dynamodb.AttributeValue, proj []string) ([]map[string]*dynamodb.AttributeValue, error) {
+	if len(keys) > MaxTransactGet {
+		return nil, fmt.Errorf("too many keys for a transaction: %v (max %v)", len(keys), MaxTransactGet)
+	}
+
+	var expr expression.Expression
+	if len(proj) > 0 {
+		var err error
+		expr, err = withFilter(expression.NewBuilder(), nil, proj).Build()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var items []*dynamodb.TransactGetItem
+	for _, k := range keys {
+		items = append(items, &dynamodb.TransactGetItem{Get: &dynamodb.Get{
+			TableName:                aws.String(table),
+			Key:                      k,
+			ProjectionExpression:     expr.Projection(),
+			ExpressionAttributeNames: expr.Names(),
+		}})
+	}
+
+	var out *dynamodb.TransactGetItemsOutput
+	err := retry(func() error {
+		var err error
+		out, err = svc.TransactGetItems(&dynamodb.TransactGetItemsInput{TransactItems: items})
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("transaction failed: %w", err)
+	}
+
+	res := make([]map[string]*dynamodb.AttributeValue, len(out.Responses))
+	for i, v := range out.Responses {
+		if len(v.Item) > 0 {
+			res[i] = v.Item
+		}
+	}
+
+	return res, nil
+}
+
+// pageLimit returns the Limit of each request: the page size, up to limit (if
+// set), or limit.
+func pageLimit(limit, size int64) int64 {
+	if size > 0 && (limit == 0 || size < limit) {
+		return size
+	}
+
+	return limit
+}
+
+// DeleteItem deletes the item with key from table.
+func DeleteItem(svc *dynamodb.DynamoDB, table string, key map[string]*dynamodb.AttributeValue) error {
+	return retry(func() error {
+		_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String(table),
+			Key:       key,
+		})
+
+		return err
+	})
+}
+
+// DeleteItemOld deletes the item with key from table, and returns it as it was
+// (ReturnValues ALL_OLD), nil if there was no such item.
+func DeleteItemOld(svc *dynamodb.DynamoDB, table string, key map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	var old map[string]*dynamodb.AttributeValue
+	err := retry(func() error {
+		out, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName:    aws.String(table),
+			Key:          key,
+			ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		old = out.Attributes
+		return nil
+	})
+
+	return old, err
+}
+
+// KeyValue returns v as a key attribute value of type typ (S, N, or B, base64
+// encoded), S if empty.
+func KeyValue(typ, v string) (*dynamodb.AttributeValue, error) {
+	switch typ {
+	case "", dynamodb.ScalarAttributeTypeS:
+		return &dynamodb.AttributeValue{S: aws.String(v)}, nil
+	case dynamodb.ScalarAttributeTypeN:
+		return &dynamodb.AttributeValue{N: aws.String(v)}, nil
+	case dynamodb.ScalarAttributeTypeB:
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid binary key value: %v", v)
+		}
+
+		return &dynamodb.AttributeValue{B: b}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %v", typ)
+	}
+}
+
+// KeyTypes returns the types of the key attributes of t, for Query.Types.
+func KeyTypes(t *dynamodb.TableDescription) map[string]string {
+	types := make(map[string]string)
+	for _, v := range t.AttributeDefinitions {
+		types[aws.StringValue(v.AttributeName)] = aws.StringValue(v.AttributeType)
+	}
+
+	return types
+}
+
+// splitBetween splits a <attr:low:high> Between value, at the middle ':' of
+// low:high, so that both can contain ':' (i.e. RFC3339 timestamps).
+func splitBetween(v string) (string, string, string, error) {
+	attr, rng, err := splitKey("sk-between", v)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	n := strings.Count(rng, ":")
+	if n%2 == 0 {
+		return "", "", "", fmt.Errorf("invalid --sk-between format: %v (low and high must have the same number of ':')", v)
+	}
+
+	i := 0
+	for c := 0; c <= n/2; c++ {
+		i += strings.Index(rng[i:], ":") + 1
+	}
+
+	return attr, rng[:i-1], rng[i:], nil
+}
+
+// splitKey splits a <attr:value> key flag; the value can contain ':'.
+func splitKey(flag, v string) (string, string, error) {
+	sp := strings.SplitN(v, ":", 2)
+	if len(sp) != 2 || sp[0] == "" {
+		return "", "", fmt.Errorf("invalid --%v format: %v", flag, v)
+	}
+
+	return sp[0], sp[1], nil
+}
+
+func withFilter(b expression.Builder, filter *expression.ConditionBuilder, proj []string) expression.Builder {
+	if filter != nil {
+		b = b.WithFilter(*filter)
+	}
+
+	if len(proj) > 0 {
+		var names []expression.NameBuilder
+		for _, v := range proj {
+			names = append(names, expression.Name(v))
+		}
+
+		b = b.WithProjection(expression.NamesList(names[0], names[1:]...))
+	}
+
+	return b
+}
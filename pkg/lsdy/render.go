@@ -0,0 +1,284 @@
+package lsdy
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Layout is how Write lays out the rows.
+type Layout int
+
+const (
+	TableLayout     Layout = iota
+	VerticalLayout         // see Vertical
+	TransposeLayout        // see Transpose
+)
+
+// Render holds the display options of the layouts.
+type Render struct {
+	ColWidth int  // max column width, 0 means tablewriter's default
+	NoWrap   bool // if set, the table doesn't wrap cells (i.e. the caller does)
+	NoBorder bool
+	Layout   Layout
+
+	// If > 0, the table columns are shrunk (widest first) with Shorten to fit in
+	// this display width.
+	Fit     int
+	Shorten func(v string, n int) string
+
+	// If set, the per-cell colors of the i'th (0-based) row of n cells, and the
+	// headers are colored too.
+	Colors func(i int, r Row, n int) []tablewriter.Colors
+}
+
+// Number prefixes the csv cells of rows with their numbers (1-based), and in the
+// table layout, the table cells, and the returned hdrs as well; the other layouts
+// are numbered already.
+func (r *Render) Number(hdrs []string, rows []Row) []string {
+	if r.Layout == TableLayout {
+		hdrs = append([]string{"#"}, hdrs...)
+	}
+
+	for i := range rows {
+		n := strconv.Itoa(i + 1)
+		rows[i].CSV = append([]string{n}, rows[i].CSV...)
+		if r.Layout == TableLayout {
+			rows[i].Cells = append([]string{n}, rows[i].Cells...)
+		}
+	}
+
+	return hdrs
+}
+
+// Write writes rows, with the headers hdrs, to w in the Layout.
+func (r *Render) Write(w io.Writer, hdrs []string, rows []Row) {
+	if r.Layout == VerticalLayout {
+		r.Vertical(w, hdrs, Cells(rows))
+		return
+	}
+
+	table := r.Table(w)
+	if r.Layout == TransposeLayout {
+		th, tr := r.Transpose(hdrs, Cells(rows))
+		table.SetHeader(th)
+		var ic []tablewriter.Colors // per item (column)
+		if r.Colors != nil {
+			table.SetHeaderColor(headerColors(len(th))...)
+			ic = append(ic, nil)
+			for i, row := range rows {
+				ic = append(ic, r.Colors(i, row, 1)[0])
+			}
+		}
+
+		for _, cells := range tr {
+			if r.Colors != nil {
+				table.Rich(cells, ic)
+			} else {
+				table.Append(cells)
+			}
+		}
+
+		table.Render()
+		return
+	}
+
+	if r.Fit > 0 {
+		overhead := 3 // '| ' + ' '
+		if r.NoBorder {
+			overhead = 2
+		}
+
+		fw := fitWidths(hdrs, rows, r.Fit, overhead, 4)
+		maxw := 0
+		for _, n := range fw {
+			if n > maxw {
+				maxw = n
+			}
+		}
+
+		table.SetColWidth(maxw)
+		for _, row := range rows {
+			for i := range row.Cells {
+				row.Cells[i] = r.Shorten(row.Cells[i], fw[i])
+			}
+		}
+	}
+
+	for i, row := range rows {
+		if r.Colors != nil {
+			table.Rich(row.Cells, r.Colors(i, row, len(hdrs)))
+		} else {
+			table.Append(row.Cells)
+		}
+	}
+
+	table.SetHeader(hdrs)
+	if r.Colors != nil {
+		table.SetHeaderColor(headerColors(len(hdrs))...)
+	}
+
+	table.Render()
+}
+
+// headerColors returns the colors of n header cells.
+func headerColors(n int) []tablewriter.Colors {
+	hc := make([]tablewriter.Colors, n)
+	for i := range hc {
+		hc[i] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor}
+	}
+
+	return hc
+}
+
+// Table returns a table writer to w, left-aligned, with the headers as is.
+func (r *Render) Table(w io.Writer) *tablewriter.Table {
+	table := tablewriter.NewWriter(w)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	if r.ColWidth > 0 {
+		table.SetColWidth(r.ColWidth)
+	}
+
+	if r.NoWrap {
+		table.SetAutoWrapText(false)
+	}
+
+	if r.NoBorder {
+		table.SetBorder(false)
+		table.SetHeaderLine(false)
+		table.SetColumnSeparator("")
+		table.SetTablePadding("  ")
+		table.SetNoWhiteSpace(true)
+	}
+
+	return table
+}
+
+// Vertical writes each row as a block of 'attribute: value' lines, separated by a
+// rule with the row number, similar to MySQL's \G output. Multiline values are
+// indented to line up with the first line.
+func (r *Render) Vertical(w io.Writer, hdrs []string, rows [][]string) {
+	namew := 0
+	for _, h := range hdrs {
+		if n := runewidth.StringWidth(h); n > namew {
+			namew = n
+		}
+	}
+
+	rule := strings.Repeat("*", 27)
+	indent := strings.Repeat(" ", namew+2)
+	for i, cells := range rows {
+		fmt.Fprintf(w, "%v %v. row %v\n", rule, i+1, rule)
+		for j, h := range hdrs {
+			var v string
+			if j < len(cells) {
+				v = cells[j]
+			}
+
+			pad := strings.Repeat(" ", namew-runewidth.StringWidth(h))
+			v = strings.Replace(v, "\n", "\n"+indent, -1)
+			fmt.Fprintf(w, "%v%v: %v\n", pad, h, v)
+		}
+	}
+}
+
+// Transpose returns the headers and rows of the table with attributes as rows and
+// items as columns. Items are labeled with their row numbers (1-based).
+func (r *Render) Transpose(hdrs []string, rows [][]string) ([]string, [][]string) {
+	th := []string{"attribute"}
+	for i := range rows {
+		th = append(th, strconv.Itoa(i+1))
+	}
+
+	var tr [][]string
+	for j, h := range hdrs {
+		cells := []string{h}
+		for _, rc := range rows {
+			var v string
+			if j < len(rc) {
+				v = rc[j]
+			}
+
+			cells = append(cells, v)
+		}
+
+		tr = append(tr, cells)
+	}
+
+	return th, tr
+}
+
+// cellWidth returns the display width of the widest line in v.
+func cellWidth(v string) int {
+	w := 0
+	for _, l := range strings.Split(v, "\n") {
+		if n := runewidth.StringWidth(l); n > w {
+			w = n
+		}
+	}
+
+	return w
+}
+
+// fitWidths returns the column widths that make the table fit in total display
+// width: the widest columns are shrunk first, down to a common cap, while narrow
+// columns keep their natural width. overhead is the per-column decoration width
+// (borders, padding), and minw the narrowest a column can get.
+func fitWidths(hdrs []string, rows []Row, total, overhead, minw int) []int {
+	natural := make([]int, len(hdrs))
+	for i, h := range hdrs {
+		natural[i] = cellWidth(h)
+	}
+
+	for _, r := range rows {
+		for i, c := range r.Cells {
+			if i < len(natural) {
+				if n := cellWidth(c); n > natural[i] {
+					natural[i] = n
+				}
+			}
+		}
+	}
+
+	avail := total - overhead*len(hdrs) - 1
+	sum := func(capw int) int {
+		s := 0
+		for _, n := range natural {
+			if n > capw {
+				n = capw
+			}
+
+			s += n
+		}
+
+		return s
+	}
+
+	// Find the largest width cap that fits.
+	capw := 0
+	for _, n := range natural {
+		if n > capw {
+			capw = n
+		}
+	}
+
+	for capw > minw && sum(capw) > avail {
+		capw--
+	}
+
+	out := make([]int, len(natural))
+	for i, n := range natural {
+		out[i] = n
+		if n > capw {
+			out[i] = capw
+		}
+	}
+
+	return out
+}
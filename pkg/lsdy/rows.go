@@ -0,0 +1,695 @@
+package lsdy
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Row is a single output line, along with the item it came from.
+type Row struct {
+	Item  map[string]interface{}
+	Cells []string // table cells
+	CSV   []string // csv cells
+	Mark  string   // change mark, i.e. of lsdy's --watch
+}
+
+// Cells returns the table cells of rows.
+func Cells(rows []Row) [][]string {
+	out := make([][]string, len(rows))
+	for i, r := range rows {
+		out[i] = r.Cells
+	}
+
+	return out
+}
+
+// Top is a parsed --top/--bottom value, fmt: <N:by=attr>.
+type Top struct {
+	N    int
+	By   string
+	Desc bool // true for --top, false for --bottom
+}
+
+func ParseTop(v string, desc bool) (*Top, error) {
+	sp := strings.SplitN(v, ":", 2)
+	if len(sp) != 2 || !strings.HasPrefix(sp[1], "by=") {
+		return nil, fmt.Errorf("invalid format: %v", v)
+	}
+
+	n, err := strconv.Atoi(sp[0])
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid count: %v", v)
+	}
+
+	by := strings.TrimPrefix(sp[1], "by=")
+	if by == "" {
+		return nil, fmt.Errorf("empty attribute: %v", v)
+	}
+
+	return &Top{N: n, By: by, Desc: desc}, nil
+}
+
+// SortKey is a parsed --sort-by value, fmt: <attr[:asc|:desc]>.
+type SortKey struct {
+	Attr string
+	Desc bool
+}
+
+// ParseSortKeys parses the --sort-by values, empty ones are skipped.
+func ParseSortKeys(specs []string) []SortKey {
+	var keys []SortKey
+	for _, v := range specs {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		k := SortKey{Attr: v}
+		switch {
+		case strings.HasSuffix(v, ":desc"):
+			k.Attr, k.Desc = strings.TrimSuffix(v, ":desc"), true
+		case strings.HasSuffix(v, ":asc"):
+			k.Attr = strings.TrimSuffix(v, ":asc")
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// Pipeline turns unmarshaled items into rows: the columns, and their headers,
+// the cell values (replaced, decoded, transformed, hashed, masked, and fit in
+// their width), and then the rows kept (filtered, deduped, ranked, sorted, and
+// skipped), in that order.
+type Pipeline struct {
+	Attrs  []string          // columns, in order, all the attributes found if empty
+	NoSort bool              // if set, the attributes found are not sorted
+	Pin    []string          // columns moved to the front, in order, if present
+	Rename map[string]string // headers of the columns, other than the attribute name
+
+	Explode      string // list attribute to emit a row per element of
+	Flatten      bool
+	FlattenDepth int
+
+	Format     Format
+	Exec       map[string]map[string]string // per attribute, the values replaced, i.e. by external commands
+	Decode     []string                     // positional base64 decoding, fmt: <col[:sep:idx][:decoder]>
+	Transforms []*Transform
+	OnError    func(t *Transform, err error) // called on each failed value, which is kept as is
+	Contains   []string                      // fmt: <col-index:[[^]regex:]expr>
+	Hashes     map[string]*Hash              // by attribute
+	Masks      map[string]*Mask              // by attribute
+
+	Width     func(attr string) int        // max width of a column's cells, no max if nil
+	Shorten   func(v string, n int) string // if set, the table cells are fit in their width
+	CSVStrict bool                         // if set, csv cells are kept whole, and empty if missing
+	CSVCols   []int                        // csv columns, as indexes in the columns (-1 if not there), all if nil
+
+	Dedupe   bool
+	DedupeBy []string // attributes to dedupe on, all the columns if empty
+	Top      *Top
+	SortBy   []SortKey
+	Skip     int64
+}
+
+// Prepare returns items with the Explode, Flatten, and nested path Attrs applied.
+func (p *Pipeline) Prepare(items []map[string]interface{}) []map[string]interface{} {
+	if p.Explode != "" {
+		var exploded []map[string]interface{}
+		for _, v := range items {
+			exploded = append(exploded, Explode(v, p.Explode)...)
+		}
+
+		items = exploded
+	}
+
+	if p.Flatten {
+		for i := range items {
+			items[i] = Flatten(items[i], p.FlattenDepth)
+		}
+	}
+
+	// Resolve nested attribute paths into their own columns.
+	for _, v := range p.Attrs {
+		if !IsPath(v) {
+			continue
+		}
+
+		for i := range items {
+			if _, ok := items[i][v]; ok {
+				continue
+			}
+
+			if val, ok := LookupPath(items[i], v); ok {
+				items[i][v] = val
+			}
+		}
+	}
+
+	return items
+}
+
+// Columns returns the attributes displayed: Attrs, or all the attributes of
+// items, sorted unless NoSort is set, with Pin first.
+func (p *Pipeline) Columns(items []map[string]interface{}) []string {
+	cols := []string{}
+	switch {
+	case len(p.Attrs) > 0:
+		cols = append(cols, p.Attrs...)
+	default:
+		lbl := make(map[string]struct{})
+		for _, item := range items {
+			for k := range item {
+				lbl[k] = struct{}{}
+			}
+		}
+
+		for k := range lbl {
+			cols = append(cols, k)
+		}
+
+		if !p.NoSort {
+			sort.Strings(cols)
+		}
+	}
+
+	if len(p.Pin) > 0 {
+		cols = pinColumns(cols, p.Pin)
+	}
+
+	return cols
+}
+
+// Headers returns the headers of cols, see Rename.
+func (p *Pipeline) Headers(cols []string) []string {
+	var hdrs []string
+	for _, v := range cols {
+		if a, ok := p.Rename[v]; ok {
+			v = a
+		}
+
+		hdrs = append(hdrs, v)
+	}
+
+	return hdrs
+}
+
+// Rows returns the rows of items, for the columns cols.
+func (p *Pipeline) Rows(items []map[string]interface{}, cols []string) []Row {
+	var out []Row
+	var ranked *topN
+	var seen map[string]struct{}
+	dedupeBy := p.DedupeBy
+	if p.Dedupe {
+		seen = make(map[string]struct{})
+		if len(dedupeBy) == 0 {
+			dedupeBy = cols
+		}
+	}
+
+	if p.Top != nil {
+		ranked = newTopN(p.Top)
+	}
+
+	for _, item := range items {
+		cells, qcells, ok := p.cells(item, cols)
+		if !ok {
+			continue
+		}
+
+		r := Row{Item: item, Cells: cells, CSV: p.csvCells(qcells)}
+		if seen != nil {
+			k := DedupeKey(r, dedupeBy, p.Format)
+			if _, ok := seen[k]; ok {
+				continue
+			}
+
+			seen[k] = struct{}{}
+		}
+
+		if ranked != nil {
+			ranked.Add(r)
+			continue
+		}
+
+		out = append(out, r)
+	}
+
+	if ranked != nil {
+		out = ranked.Rows()
+	}
+
+	if len(p.SortBy) > 0 {
+		sortRows(out, p.SortBy)
+	}
+
+	if p.Skip > 0 {
+		if int64(len(out)) > p.Skip {
+			out = out[p.Skip:]
+		} else {
+			out = nil
+		}
+	}
+
+	return out
+}
+
+// cells returns the table, and csv cells of item, and false if it's filtered out
+// by Contains.
+func (p *Pipeline) cells(item map[string]interface{}, cols []string) ([]string, []string, bool) {
+	include := true
+	var cells, qcells []string
+	for i, k := range cols {
+		if _, ok := item[k]; !ok {
+			cells = append(cells, "-")
+			if p.CSVStrict {
+				qcells = append(qcells, "")
+			} else {
+				qcells = append(qcells, "-")
+			}
+
+			continue
+		}
+
+		v := p.Format.Value(item[k])
+		raw := v
+		if ex, ok := p.Exec[k]; ok {
+			v = ex[v]
+		}
+
+		v = p.decode(i, k, v)
+		v = p.transform(k, v)
+		include = p.contains(include, i, v)
+		if rv, ok := p.Redact(k, v); ok {
+			v = rv
+		}
+
+		width := p.width(k)
+		if p.Shorten != nil {
+			cells = append(cells, p.Shorten(v, width))
+		} else {
+			cells = append(cells, v)
+		}
+
+		// Numbers, and booleans (unless transformed) are written whole, as plain
+		// numbers, and true/false, so that they keep their type in spreadsheets,
+		// and loaders.
+		if typedCell(item[k]) && v == raw {
+			qcells = append(qcells, v)
+			continue
+		}
+
+		// With CSVStrict, the values are kept whole, and quoted as needed by the
+		// csv writer.
+		if !p.CSVStrict {
+			if len(v) > width {
+				v = v[:width]
+			}
+
+			v = strings.Replace(v, "\"", "'", -1)
+		}
+
+		qcells = append(qcells, v)
+	}
+
+	return cells, qcells, include
+}
+
+// width returns the max width of the cells of attr.
+func (p *Pipeline) width(attr string) int {
+	if p.Width == nil {
+		return math.MaxInt
+	}
+
+	return p.Width(attr)
+}
+
+// decode applies Decode to v, the value of column i, attribute k.
+func (p *Pipeline) decode(i int, k, v string) string {
+	for _, decv := range p.Decode {
+		sp := strings.Split(decv, ":")
+		dec := Transforms["b64"]
+		if len(sp) > 1 { // '1:gz', '1:|:3:zstd'
+			if fn, ok := Decoders[sp[len(sp)-1]]; ok {
+				dec = fn
+				sp = sp[:len(sp)-1]
+			}
+		}
+
+		switch {
+		case len(sp) == 1: // '0', '2', 'attr', ...
+			if colmatch(sp[0], i, k) {
+				data, err := dec(v, nil)
+				if err == nil {
+					v = data
+				}
+			}
+		case len(sp) == 3: // '1:|:3', 'attr:|:3'
+			sidx, _ := strconv.Atoi(sp[2])
+			if colmatch(sp[0], i, k) {
+				sr := strings.Split(v, sp[1])
+				if len(sr) > 1 && sidx < len(sr) {
+					data, err := dec(sr[sidx], nil)
+					if err == nil {
+						sr[sidx] = data
+						v = strings.Join(sr, sp[1])
+					}
+				}
+			}
+		}
+	}
+
+	return v
+}
+
+// transform applies the Transforms of attribute k to v.
+func (p *Pipeline) transform(k, v string) string {
+	for _, t := range p.Transforms {
+		if t.Attr != k {
+			continue
+		}
+
+		out, err := t.Apply(v)
+		if err != nil {
+			if p.OnError != nil {
+				p.OnError(t, err)
+			}
+
+			continue
+		}
+
+		v = out
+	}
+
+	return v
+}
+
+// contains returns whether the row is included, after the Contains filters of
+// column i, with value v. include is the result of the previous columns.
+func (p *Pipeline) contains(include bool, i int, v string) bool {
+	for _, fltr := range p.Contains {
+		cc := strings.Split(fltr, ":") // '0:[[!]regex:]expr'
+		switch {
+		case len(cc) == 2: // not regex
+			idx, _ := strconv.Atoi(cc[0])
+			if idx == i {
+				if cc[1][0] == '^' {
+					if strings.Contains(v, cc[1][1:]) {
+						include = false
+					}
+				} else {
+					include = false
+					if strings.Contains(v, cc[1]) {
+						include = true
+					}
+				}
+			}
+		case len(cc) == 3: // regex version
+			idx, _ := strconv.Atoi(cc[0])
+			if idx == i {
+				re := regexp.MustCompile(cc[2])
+				match := re.MatchString(v)
+				switch cc[1] {
+				case "^regex":
+					include = !match
+				case "regex":
+					include = match
+				}
+			}
+		}
+	}
+
+	return include
+}
+
+// Redact returns v, the value of attr, hashed, and/or masked, and false if attr
+// is neither.
+func (p *Pipeline) Redact(attr, v string) (string, bool) {
+	h, hok := p.Hashes[attr]
+	m, mok := p.Masks[attr]
+	if hok {
+		v = h.Apply(v)
+	}
+
+	if mok {
+		v = m.Apply(v)
+	}
+
+	return v, hok || mok
+}
+
+// Full returns the full (untruncated) item of r, hashed/masked attributes stay
+// that way.
+func (p *Pipeline) Full(r Row) map[string]interface{} {
+	item := make(map[string]interface{})
+	for k, v := range r.Item {
+		if rv, ok := p.Redact(k, p.Format.Value(v)); ok {
+			v = rv
+		}
+
+		item[k] = v
+	}
+
+	return item
+}
+
+// csvCells returns the csv cells of a row (of all the columns) in the order of
+// CSVCols. The columns that are not there are missing attributes.
+func (p *Pipeline) csvCells(qcells []string) []string {
+	if p.CSVCols == nil {
+		return qcells
+	}
+
+	out := make([]string, len(p.CSVCols))
+	for i, j := range p.CSVCols {
+		switch {
+		case j >= 0:
+			out[i] = qcells[j]
+		case p.CSVStrict:
+			out[i] = ""
+		default:
+			out[i] = "-"
+		}
+	}
+
+	return out
+}
+
+// typedCell returns true if v, an attribute value, is a number (N), or a boolean
+// (BOOL), written as is in the csv cells.
+func typedCell(v interface{}) bool {
+	switch v.(type) {
+	case float64, json.Number, bool:
+		return true
+	}
+
+	return false
+}
+
+// colmatch returns true if ref, either a column index or an attribute name,
+// refers to column i with attribute name k. Names are preferred since indexes
+// depend on the (sorted, discovered) set of attributes.
+func colmatch(ref string, i int, k string) bool {
+	if idx, err := strconv.Atoi(ref); err == nil {
+		return idx == i
+	}
+
+	return ref == k
+}
+
+// pinColumns moves the pinned columns (if present in cols) to the front, in the
+// order given, keeping the relative order of the remaining columns.
+func pinColumns(cols, pinned []string) []string {
+	present := make(map[string]struct{})
+	for _, v := range cols {
+		present[v] = struct{}{}
+	}
+
+	var out []string
+	done := make(map[string]struct{})
+	for _, v := range pinned {
+		if _, ok := present[v]; !ok {
+			continue
+		}
+
+		if _, ok := done[v]; ok {
+			continue
+		}
+
+		out = append(out, v)
+		done[v] = struct{}{}
+	}
+
+	for _, v := range cols {
+		if _, ok := done[v]; !ok {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+// DedupeKey returns the key used to detect duplicate rows, from the values of the
+// named attributes of the row's item, whole, and as formatted by f, i.e. before
+// any width limit, transform, or redaction of the cells.
+func DedupeKey(r Row, attrs []string, f Format) string {
+	var vals []string
+	for _, a := range attrs {
+		if v, ok := r.Item[a]; ok {
+			vals = append(vals, f.Value(v))
+		} else {
+			vals = append(vals, "\x01") // missing
+		}
+	}
+
+	return strings.Join(vals, "\x00")
+}
+
+// numval returns the numeric value of v for ranking purposes. Numbers are used as
+// is, strings are parsed as numbers first, then as RFC3339 timestamps.
+func numval(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return f, true
+		}
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return f, true
+		}
+
+		if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return float64(ts.UnixNano()), true
+		}
+	}
+
+	return 0, false
+}
+
+type rankedRow struct {
+	val float64
+	r   Row
+}
+
+// rankHeap keeps the "worst" ranked row at the root so it can be evicted once we
+// are above capacity.
+type rankHeap struct {
+	rows []rankedRow
+	desc bool
+}
+
+func (h rankHeap) Len() int { return len(h.rows) }
+
+func (h rankHeap) Less(i, j int) bool {
+	if h.desc {
+		return h.rows[i].val < h.rows[j].val
+	}
+
+	return h.rows[i].val > h.rows[j].val
+}
+
+func (h rankHeap) Swap(i, j int)       { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *rankHeap) Push(x interface{}) { h.rows = append(h.rows, x.(rankedRow)) }
+
+func (h *rankHeap) Pop() interface{} {
+	old := h.rows
+	n := len(old)
+	x := old[n-1]
+	h.rows = old[:n-1]
+	return x
+}
+
+// topN keeps only the N best rows, as defined by spec, as rows are added. Rows
+// without a numeric (or timestamp) value for the attribute are dropped.
+type topN struct {
+	spec *Top
+	h    *rankHeap
+}
+
+func newTopN(spec *Top) *topN {
+	return &topN{spec: spec, h: &rankHeap{desc: spec.Desc}}
+}
+
+func (t *topN) Add(r Row) {
+	v, ok := numval(r.Item[t.spec.By])
+	if !ok {
+		return
+	}
+
+	heap.Push(t.h, rankedRow{val: v, r: r})
+	if t.h.Len() > t.spec.N {
+		heap.Pop(t.h)
+	}
+}
+
+// Rows returns the kept rows, best first.
+func (t *topN) Rows() []Row {
+	out := make([]Row, t.h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(t.h).(rankedRow).r
+	}
+
+	return out
+}
+
+// cmpval compares a and b, numerically if both are numbers (or timestamps),
+// otherwise as strings. Missing values are always sorted last.
+func cmpval(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	fa, oka := numval(a)
+	fb, okb := numval(b)
+	if oka && okb {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+// sortRows sorts rows by the given keys, in order. The sort is stable so rows
+// that are equal on all keys keep their original (storage) order.
+func sortRows(rows []Row, keys []SortKey) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := rows[i].Item[k.Attr], rows[j].Item[k.Attr]
+			c := cmpval(a, b)
+			if k.Desc && a != nil && b != nil {
+				c = -c
+			}
+
+			if c != 0 {
+				return c < 0
+			}
+		}
+
+		return false
+	})
+}
@@ -0,0 +1,145 @@
+package lsdy
+
+import (
+	"crypto/sha256"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestPipelineRows(t *testing.T) {
+	items := []map[string]interface{}{
+		{"id": "a", "n": float64(3), "email": "ann@example.com"},
+		{"id": "b", "n": float64(10), "email": "bob@example.com"},
+		{"id": "c", "n": float64(1), "email": "cat@example.com"},
+		{"id": "a", "n": float64(3), "email": "ann@example.com"},
+		{"id": "d", "n": float64(7), "email": "dan@example.com"},
+	}
+
+	hs := &Hash{Attr: "id", Algo: "sha256", New: sha256.New}
+	for _, tc := range []struct {
+		name string
+		p    *Pipeline
+		cols []string
+		want [][]string
+	}{
+		{
+			name: "dedupe",
+			p:    &Pipeline{Dedupe: true},
+			cols: []string{"id"},
+			want: [][]string{{"a"}, {"b"}, {"c"}, {"d"}},
+		},
+		{
+			name: "top, then sort, then skip",
+			p: &Pipeline{
+				Top:    &Top{N: 3, By: "n", Desc: true},
+				SortBy: []SortKey{{Attr: "id"}},
+				Skip:   1,
+			},
+			cols: []string{"id", "n"},
+			want: [][]string{{"b", "10"}, {"d", "7"}},
+		},
+		{
+			name: "contains",
+			p:    &Pipeline{Contains: []string{"1:^0"}, SortBy: []SortKey{{Attr: "n", Desc: true}}},
+			cols: []string{"id", "n"},
+			want: [][]string{{"d", "7"}, {"a", "3"}, {"a", "3"}, {"c", "1"}},
+		},
+		{
+			name: "mask, and hash",
+			p: &Pipeline{
+				Masks:  map[string]*Mask{"email": {Attr: "email", Prefix: 1, Suffix: 4}},
+				Hashes: map[string]*Hash{"id": hs},
+				Top:    &Top{N: 1, By: "n", Desc: true},
+			},
+			cols: []string{"id", "email"},
+			want: [][]string{{hs.Apply("b"), "b****.com"}},
+		},
+	} {
+		got := Cells(tc.p.Rows(items, tc.cols))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPipelineDedupe(t *testing.T) {
+	// Only the cells (of width 4) are the same.
+	items := []map[string]interface{}{
+		{"id": "abcd1", "n": float64(1)},
+		{"id": "abcd2", "n": float64(1)},
+		{"id": "abcd1", "n": float64(1)},
+	}
+
+	p := &Pipeline{
+		Width: func(string) int { return 4 },
+		Shorten: func(v string, n int) string {
+			if len(v) > n {
+				v = v[:n]
+			}
+
+			return v
+		},
+		Masks:  map[string]*Mask{"id": {Attr: "id", Prefix: 1}},
+		Dedupe: true,
+	}
+
+	rows := p.Rows(items, []string{"id", "n"})
+	if len(rows) != 2 || rows[0].Item["id"] != "abcd1" || rows[1].Item["id"] != "abcd2" {
+		t.Errorf("got %v rows, want abcd1, abcd2", len(rows))
+	}
+
+	p.DedupeBy = []string{"n"}
+	if rows := p.Rows(items, []string{"id", "n"}); len(rows) != 1 {
+		t.Errorf("got %v rows, want 1", len(rows))
+	}
+}
+
+func TestPipelineColumns(t *testing.T) {
+	items := []map[string]interface{}{
+		{"id": "a", "ts": "1", "cfg": map[string]interface{}{"name": "x"}},
+		{"id": "b", "z": "2"},
+	}
+
+	p := &Pipeline{Pin: []string{"ts", "id"}, Rename: map[string]string{"ts": "time"}}
+	cols := p.Columns(items)
+	if want := []string{"ts", "id", "cfg", "z"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("got %q, want %q", cols, want)
+	}
+
+	if got, want := p.Headers(cols), []string{"time", "id", "cfg", "z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	p = &Pipeline{Attrs: []string{"id", "cfg.name"}}
+	items = p.Prepare(items)
+	rows := p.Rows(items, p.Columns(items))
+	if got, want := Cells(rows), [][]string{{"a", "x"}, {"b", "-"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPipelineNumbers(t *testing.T) {
+	// Beyond 2^53, which float64 rounds to 1234567890123456768.
+	items, err := UnmarshalItems([]map[string]*dynamodb.AttributeValue{{
+		"id": {S: aws.String("a")},
+		"n":  {N: aws.String("1234567890123456789")},
+		"m":  {M: map[string]*dynamodb.AttributeValue{"n": {N: aws.String("1234567890123456789")}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Pipeline{CSVStrict: true}
+	var got [][]string
+	for _, r := range p.Rows(items, []string{"id", "n", "m"}) {
+		got = append(got, r.CSV)
+	}
+
+	want := [][]string{{"a", "1234567890123456789", `{"n":1234567890123456789}`}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,475 @@
+package lsdy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// TransformFunc converts a cell value. args are the transform's parameters, if any.
+type TransformFunc func(v string, args []string) (string, error)
+
+// Transforms are the supported --transform names, i.e. for other tools to add
+// their own.
+var Transforms = map[string]TransformFunc{
+	"json":         jsonTransform,
+	"ts":           tsTransform,
+	"b64":          b64Transform,
+	"gz":           gzTransform,
+	"zstd":         zstdTransform,
+	"snappy":       snappyTransform,
+	"msgpack":      msgpackTransform,
+	"urldecode":    urldecodeTransform,
+	"htmlunescape": htmlunescapeTransform,
+	"hex":          hexTransform,
+}
+
+// Decoders are the transforms that can be chained after --decb64's base64 decoding.
+var Decoders = map[string]TransformFunc{
+	"gz":     gzTransform,
+	"zstd":   zstdTransform,
+	"snappy": snappyTransform,
+}
+
+// binaryInput are the transforms of binary data, which base64-decode their input
+// first, unless given the 'raw' arg. In a pipeline, 'raw' is implied after a 'b64'
+// step, i.e. 'payload:b64|gz' is the same as 'payload:gz'.
+var binaryInput = map[string]bool{
+	"gz":      true,
+	"zstd":    true,
+	"snappy":  true,
+	"msgpack": true,
+}
+
+// TransformStep is a single named transform in a --transform pipeline.
+type TransformStep struct {
+	Name string
+	Args []string
+	Fn   TransformFunc
+}
+
+// Transform is a parsed --transform value, fmt: <attr:step[|step...]>, where
+// each step is either <name[:arg...]> or <name[.arg][(arg[,arg...])]>, i.e.
+// 'payload:b64|gz|json.path(.foo)', 'created_at:ts:ms:Asia/Tokyo'. Steps are
+// applied left to right. The binary decoders (gz, zstd, snappy, msgpack) take
+// the bytes of a preceding b64 step as is, base64 values otherwise.
+type Transform struct {
+	Attr  string
+	Steps []TransformStep
+}
+
+func ParseTransform(v string) (*Transform, error) {
+	i := strings.Index(v, ":")
+	if i <= 0 || i == len(v)-1 {
+		return nil, fmt.Errorf("invalid --transform format: %v", v)
+	}
+
+	spec := &Transform{Attr: v[:i]}
+	for _, s := range splitPipeline(v[i+1:]) {
+		step, err := parseStep(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --transform %v: %v", v, err)
+		}
+
+		if n := len(spec.Steps); n > 0 && spec.Steps[n-1].Name == "b64" && binaryInput[step.Name] {
+			step.Args = append(step.Args, "raw")
+		}
+
+		spec.Steps = append(spec.Steps, step)
+	}
+
+	return spec, nil
+}
+
+// splitPipeline splits a pipeline on '|', except inside parentheses.
+func splitPipeline(v string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, c := range v {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case '|':
+			if depth == 0 {
+				out = append(out, v[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(out, v[start:])
+}
+
+func parseStep(v string) (TransformStep, error) {
+	var step TransformStep
+	v = strings.TrimSpace(v)
+	var paren []string
+	if i := strings.Index(v, "("); i >= 0 {
+		if !strings.HasSuffix(v, ")") {
+			return step, fmt.Errorf("unbalanced parentheses: %v", v)
+		}
+
+		if inner := v[i+1 : len(v)-1]; inner != "" {
+			paren = strings.Split(inner, ",")
+		}
+
+		v = v[:i]
+	}
+
+	sp := strings.Split(v, ":")
+	dot := strings.Split(sp[0], ".")
+	step.Name = dot[0]
+	step.Args = append(step.Args, dot[1:]...)
+	step.Args = append(step.Args, paren...)
+	step.Args = append(step.Args, sp[1:]...)
+	if step.Name == "seg" {
+		if len(step.Args) != 2 {
+			return step, fmt.Errorf("seg: expecting (sep,index)")
+		}
+
+		if _, err := strconv.Atoi(step.Args[1]); err != nil {
+			return step, fmt.Errorf("seg: invalid index: %v", step.Args[1])
+		}
+
+		return step, nil
+	}
+
+	fn, ok := Transforms[step.Name]
+	if !ok {
+		return step, fmt.Errorf("unknown transform: %v", step.Name)
+	}
+
+	step.Fn = fn
+	return step, nil
+}
+
+// Apply runs the pipeline against v. The special 'seg(sep,index)' step splits the
+// value using sep and applies the remaining steps to the index'th segment only,
+// i.e. 'seg(|,3)|b64'.
+func (t *Transform) Apply(v string) (string, error) {
+	return applySteps(t.Steps, v)
+}
+
+func applySteps(steps []TransformStep, v string) (string, error) {
+	for i, step := range steps {
+		if step.Name == "seg" {
+			idx, _ := strconv.Atoi(step.Args[1])
+			sr := strings.Split(v, step.Args[0])
+			if idx < 0 || idx >= len(sr) {
+				return "", fmt.Errorf("seg: index out of range: %v", idx)
+			}
+
+			out, err := applySteps(steps[i+1:], sr[idx])
+			if err != nil {
+				return "", err
+			}
+
+			sr[idx] = out
+			return strings.Join(sr, step.Args[0]), nil
+		}
+
+		var err error
+		v, err = step.Fn(v, step.Args)
+		if err != nil {
+			return "", fmt.Errorf("%v: %v", step.Name, err)
+		}
+	}
+
+	return v, nil
+}
+
+// jsonTransform pretty-prints (default) or compacts a JSON string. Args can be
+// 'pretty', 'compact', and/or a sub-path to extract, i.e. '.config.items[0]', or
+// 'json.path(.config.items[0])' in pipeline form.
+// Values that are not valid JSON are returned as is.
+func jsonTransform(v string, args []string) (string, error) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(v), &doc); err != nil {
+		return v, nil
+	}
+
+	compact := false
+	for _, a := range args {
+		switch {
+		case a == "compact":
+			compact = true
+		case a == "pretty":
+			compact = false
+		case a == "path": // as in 'json.path(.foo)'
+		case strings.HasPrefix(a, "."):
+			p := strings.TrimPrefix(a, ".")
+			if p == "" {
+				continue
+			}
+
+			m, ok := doc.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("json: path %v: not an object", a)
+			}
+
+			doc, ok = LookupPath(m, p)
+			if !ok {
+				return "", fmt.Errorf("json: path %v: not found", a)
+			}
+		default:
+			return "", fmt.Errorf("json: invalid arg: %v", a)
+		}
+	}
+
+	// Extracted strings are more readable unquoted.
+	if s, ok := doc.(string); ok {
+		return s, nil
+	}
+
+	var b []byte
+	var err error
+	if compact {
+		b, err = json.Marshal(doc)
+	} else {
+		b, err = json.MarshalIndent(doc, "", "  ")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// tsTransform converts an epoch timestamp to RFC3339. Args can be the unit of the
+// value ('s' (default), 'ms', 'us', 'ns') and/or a timezone name, i.e. 'Asia/Tokyo',
+// 'Local'. The default timezone is UTC.
+func tsTransform(v string, args []string) (string, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return "", fmt.Errorf("ts: not a number: %v", v)
+	}
+
+	div := 1.0 // units per second
+	loc := time.UTC
+	for _, a := range args {
+		switch a {
+		case "s":
+			div = 1
+		case "ms":
+			div = 1e3
+		case "us":
+			div = 1e6
+		case "ns":
+			div = 1e9
+		default:
+			loc, err = time.LoadLocation(a)
+			if err != nil {
+				return "", fmt.Errorf("ts: %v", err)
+			}
+		}
+	}
+
+	// Round to microseconds to hide floating point noise.
+	sec, frac := math.Modf(f / div)
+	t := time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3).In(loc)
+	if frac == 0 {
+		return t.Format(time.RFC3339), nil
+	}
+
+	return t.Format(time.RFC3339Nano), nil
+}
+
+// b64Transform decodes a base64-encoded value.
+func b64Transform(v string, args []string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// binaryArg returns the bytes of v, base64-decoded unless the 'raw' arg is set,
+// see binaryInput.
+func binaryArg(v string, args []string) ([]byte, error) {
+	for _, a := range args {
+		if a == "raw" {
+			return []byte(v), nil
+		}
+	}
+
+	return base64.StdEncoding.DecodeString(v)
+}
+
+// gzTransform base64-decodes (unless raw), then gunzips a value.
+func gzTransform(v string, args []string) (string, error) {
+	data, err := binaryArg(v, args)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+var zdec, _ = zstd.NewReader(nil)
+
+// zstdTransform base64-decodes (unless raw), then zstd-decompresses a value.
+func zstdTransform(v string, args []string) (string, error) {
+	data, err := binaryArg(v, args)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := zdec.DecodeAll(data, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// snappyTransform base64-decodes (unless raw), then snappy-decompresses a value.
+// Both the block and the framed (stream) formats are supported.
+func snappyTransform(v string, args []string) (string, error) {
+	data, err := binaryArg(v, args)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := snappy.Decode(nil, data)
+	if err == nil {
+		return string(out), nil
+	}
+
+	out, err = io.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// msgpackTransform decodes a base64-encoded (unless raw) msgpack value into JSON.
+func msgpackTransform(v string, args []string) (string, error) {
+	data, err := binaryArg(v, args)
+	if err != nil {
+		return "", err
+	}
+
+	var doc interface{}
+	if err := msgpack.Unmarshal(data, &doc); err != nil {
+		return "", err
+	}
+
+	return JSON(jsonable(doc))
+}
+
+// jsonable converts maps with non-string keys, which msgpack allows, into maps
+// that can be encoded to JSON.
+func jsonable(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, val := range t {
+			m[fmt.Sprintf("%v", k)] = jsonable(val)
+		}
+
+		return m
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = jsonable(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = jsonable(val)
+		}
+	}
+
+	return v
+}
+
+// urldecodeTransform decodes a percent-encoded value. Use the 'path' arg to keep
+// '+' as is (path segment rules instead of query rules).
+func urldecodeTransform(v string, args []string) (string, error) {
+	for _, a := range args {
+		if a == "path" {
+			return url.PathUnescape(v)
+		}
+	}
+
+	return url.QueryUnescape(v)
+}
+
+// htmlunescapeTransform unescapes HTML entities, i.e. '&lt;' to '<'.
+func htmlunescapeTransform(v string, args []string) (string, error) {
+	return html.UnescapeString(v), nil
+}
+
+// hexTransform decodes a hex-encoded value. The result is displayed as text if it
+// is printable, otherwise as a hexdump. Use the 'text' or 'dump' args to force
+// either one.
+func hexTransform(v string, args []string) (string, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(v), "0x"))
+	if err != nil {
+		return "", err
+	}
+
+	dump := !printable(data)
+	for _, a := range args {
+		switch a {
+		case "text":
+			dump = false
+		case "dump":
+			dump = true
+		}
+	}
+
+	if dump {
+		return strings.TrimSuffix(hex.Dump(data), "\n"), nil
+	}
+
+	return string(data), nil
+}
+
+// printable returns true if b is valid UTF-8 text with no control characters
+// other than whitespace.
+func printable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+
+	return true
+}
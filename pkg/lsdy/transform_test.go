@@ -0,0 +1,76 @@
+package lsdy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func gzipped(t *testing.T, v string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(v)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestTransformBinaryChain(t *testing.T) {
+	doc := `{"data":{"id":1}}`
+	b64 := base64.StdEncoding.EncodeToString
+	zw, _ := zstd.NewWriter(nil)
+	packed, err := msgpack.Marshal(map[string]int{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		spec, in, want string
+	}{
+		{"payload:b64|gz|json.path(.data)", b64(gzipped(t, doc)), "{\n  \"id\": 1\n}"},
+		{"payload:gz|json:compact", b64(gzipped(t, doc)), `{"data":{"id":1}}`},
+		{"payload:gz:raw", string(gzipped(t, doc)), doc},
+		{"payload:b64|zstd", b64(zw.EncodeAll([]byte(doc), nil)), doc},
+		{"payload:zstd", b64(zw.EncodeAll([]byte(doc), nil)), doc},
+		{"payload:b64|snappy", b64(snappy.Encode(nil, []byte(doc))), doc},
+		{"payload:b64|msgpack", b64(packed), `{"id":1}`},
+		{"payload:msgpack", b64(packed), `{"id":1}`},
+		{"token:seg(|,1)|b64|gz", "a|" + b64(gzipped(t, "x")), "a|x"},
+	} {
+		xf, err := ParseTransform(tc.spec)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.spec, err)
+		}
+
+		got, err := xf.Apply(tc.in)
+		if err != nil {
+			t.Errorf("%v: %v", tc.spec, err)
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestTransformError(t *testing.T) {
+	xf, err := ParseTransform("payload:b64|gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := xf.Apply(base64.StdEncoding.EncodeToString([]byte("not gzip"))); err == nil {
+		t.Error("expecting an error for a value that is not gzipped")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newProtoTransform returns a transform that decodes base64-encoded protobuf
+// messages into JSON, using a FileDescriptorSet (i.e. from 'protoc
+// --include_imports --descriptor_set_out'). fmt: <attr:descriptor.pb:package.Message>
+func newProtoTransform(v string) (*lsdy.Transform, error) {
+	sp := strings.Split(v, ":")
+	if len(sp) != 3 || sp[0] == "" || sp[1] == "" || sp[2] == "" {
+		return nil, usageErrorf("invalid --proto format: %v", v)
+	}
+
+	b, err := os.ReadFile(sp[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %v: %v", sp[1], err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %v: %v", sp[1], err)
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(sp[2]))
+	if err != nil {
+		return nil, fmt.Errorf("message %v: %v", sp[2], err)
+	}
+
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a message", sp[2])
+	}
+
+	fn := func(v string, args []string) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return "", err
+		}
+
+		msg := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return "", err
+		}
+
+		out, err := protojson.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+
+		return string(out), nil
+	}
+
+	return &lsdy.Transform{
+		Attr:  sp[0],
+		Steps: []lsdy.TransformStep{{Name: "proto", Fn: fn}},
+	}, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	saveCmd = &cobra.Command{
+		Use:   "save <name> <table> [flags]",
+		Short: "save a query (table and flags) under a name in the config file",
+		Long: `Save a query (table and flags) under a name in the config file (see --config),
+to be run later using 'lsdy run <name>'. Credentials (--key, --secret) are not saved.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               saveQueryCmd,
+	}
+
+	runCmd = &cobra.Command{
+		Use:   "run <name> [table] [flags]",
+		Short: "run a saved query, flags in the command line take precedence",
+		Long: `Run a query saved by 'lsdy save'. Flags in the command line take precedence over
+the saved ones, which take precedence over the config file defaults.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               runQueryCmd,
+	}
+)
+
+func saveQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := rootCmd.Flags()
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 2 {
+		return usageErrorf("expecting <name> <table>")
+	}
+
+	query := changedFlags(fs, "config")
+	query["table"] = fs.Arg(1)
+	if err := saveQuery(cfgfile, fs.Arg(0), query); err != nil {
+		return err
+	}
+
+	log.SetFlags(0)
+	log.Printf("saved %q to %v\n", fs.Arg(0), cfgfile)
+	return nil
+}
+
+func runQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := rootCmd.Flags()
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return usageErrorf("expecting <name> [table]")
+	}
+
+	table, err := applyQuery(fs, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return run(rootCmd, []string{table})
+}
+
+// applyQuery sets the flags of the named query that are not set yet, and returns
+// its table, unless overridden by table.
+func applyQuery(fs *pflag.FlagSet, name, table string) (string, error) {
+	query, err := loadQuery(cfgfile, name)
+	if err != nil {
+		return "", err
+	}
+
+	if table == "" {
+		table, _ = query["table"].(string)
+	}
+
+	if table == "" {
+		return "", fmt.Errorf("query %v: no table", name)
+	}
+
+	delete(query, "table")
+	return table, setFlags(fs, query, "query "+name)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reffrom string
+	refto   string
+
+	checkRefsCmd = &cobra.Command{
+		Use:   "check-refs --from <table.attr> --to <table.attr> [flags]",
+		Short: "verify that the references in a table exist in another table, reporting the orphans",
+		Long: `Scan the --from table, and check that each value of its --from attribute (or
+each element, for sets and lists) exists as a value of the --to attribute in the
+--to table, i.e.
+
+  lsdy check-refs --from orders.customer_id --to customers.pk
+
+The orphans (values with no match) are printed one per line, with the number of
+items referencing them, and the key of the first one. The exit status is 9 if
+there are orphans.
+
+If the --to attribute is the partition key of the table (or of one of its global
+secondary indexes), each distinct value is looked up with a query, otherwise (or
+if there are more values than items in the --to table) the --to table is scanned.
+The table prefix of --config applies to both tables.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               checkRefsQueryCmd,
+	}
+)
+
+// splitRef splits a <table.attr> flag value; the table name can contain '.'.
+func splitRef(flag, v string) (string, string, error) {
+	i := strings.LastIndex(v, ".")
+	if i <= 0 || i == len(v)-1 {
+		return "", "", usageErrorf("invalid --%v format: %v", flag, v)
+	}
+
+	return v[:i], v[i+1:], nil
+}
+
+// ref is a referenced value, and where it's referenced from.
+type ref struct {
+	typ   string // S, N, B
+	val   string // base64 for B
+	n     int    // number of items
+	first string // key of the first item
+}
+
+// refValues returns the scalar values in v (itself, or the elements of a set, or
+// list), as type, and value, or false if v can't be a reference.
+func refValues(v *dynamodb.AttributeValue) ([][2]string, bool) {
+	var out [][2]string
+	switch {
+	case v.S != nil:
+		out = append(out, [2]string{"S", *v.S})
+	case v.N != nil:
+		out = append(out, [2]string{"N", *v.N})
+	case v.B != nil:
+		out = append(out, [2]string{"B", base64.StdEncoding.EncodeToString(v.B)})
+	case v.SS != nil:
+		for _, s := range v.SS {
+			out = append(out, [2]string{"S", *s})
+		}
+	case v.NS != nil:
+		for _, s := range v.NS {
+			out = append(out, [2]string{"N", *s})
+		}
+	case v.BS != nil:
+		for _, b := range v.BS {
+			out = append(out, [2]string{"B", base64.StdEncoding.EncodeToString(b)})
+		}
+	case v.L != nil:
+		for _, e := range v.L {
+			tmp, ok := refValues(e)
+			if !ok || e.S == nil && e.N == nil && e.B == nil {
+				return nil, false
+			}
+
+			out = append(out, tmp...)
+		}
+	default:
+		return nil, false
+	}
+
+	return out, true
+}
+
+// itemKey returns the primary key of item, i.e. 'id=o1, ts=2'.
+func itemKey(t *dynamodb.TableDescription, item map[string]*dynamodb.AttributeValue) string {
+	var kv []string
+	for _, k := range t.KeySchema {
+		name := aws.StringValue(k.AttributeName)
+		for _, v := range avJSON(item[name]) {
+			kv = append(kv, fmt.Sprintf("%v=%v", name, v))
+		}
+	}
+
+	return strings.Join(kv, ", ")
+}
+
+func checkRefsQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := cmdFlags(cmd)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() > 0 {
+		return usageErrorf("unexpected arguments: %v", fs.Args())
+	}
+
+	log.SetFlags(0)
+	ftable, fattr, err := splitRef("from", reffrom)
+	if err != nil {
+		return err
+	}
+
+	ttable, tattr, err := splitRef("to", refto)
+	if err != nil {
+		return err
+	}
+
+	var prefix string
+	if cfgfile != "" {
+		prefix, err = loadConfig(rootCmd.Flags(), cfgfile, fs.Changed("config") || envname != "")
+		if err != nil {
+			return err
+		}
+	}
+
+	svc, err := newService()
+	if err != nil {
+		return err
+	}
+
+	fd, err := describeTable(svc, prefix+ftable)
+	if err != nil {
+		return err
+	}
+
+	td, err := describeTable(svc, prefix+ttable)
+	if err != nil {
+		return err
+	}
+
+	// The distinct references of the --from table.
+	refs := make(map[string]*ref)
+	var items, without, invalid int
+	proj := []string{fattr}
+	for _, k := range fd.Table.KeySchema {
+		if name := aws.StringValue(k.AttributeName); name != fattr {
+			proj = append(proj, name)
+		}
+	}
+
+	_, err = (&lsdy.Scan{
+		Table:      aws.StringValue(fd.Table.TableName),
+		Projection: proj,
+		Page: func(page []map[string]*dynamodb.AttributeValue, _ map[string]*dynamodb.AttributeValue) error {
+			for _, item := range page {
+				items++
+				v, ok := item[fattr]
+				if !ok {
+					without++
+					continue
+				}
+
+				vals, ok := refValues(v)
+				if !ok {
+					invalid++
+					log.Printf("warning: %v: %v is not a string, number, or binary (or a set, or list of them)\n", itemKey(fd.Table, item), fattr)
+					continue
+				}
+
+				for _, tv := range vals {
+					k := tv[0] + ":" + tv[1]
+					if refs[k] == nil {
+						refs[k] = &ref{typ: tv[0], val: tv[1], first: itemKey(fd.Table, item)}
+					}
+
+					refs[k].n++
+				}
+			}
+
+			return nil
+		},
+	}).Run(svc)
+
+	if err != nil {
+		return err
+	}
+
+	// The values of the --to attribute that exist, of the references.
+	found := make(map[string]bool)
+	collect := func(page []map[string]*dynamodb.AttributeValue, _ map[string]*dynamodb.AttributeValue) error {
+		for _, item := range page {
+			if v, ok := item[tattr]; ok {
+				vals, _ := refValues(v)
+				for _, tv := range vals {
+					found[tv[0]+":"+tv[1]] = true
+				}
+			}
+		}
+
+		return nil
+	}
+
+	// Querying each reference is cheaper than a scan, unless there are more of
+	// them than items (the item count is only updated every six hours or so).
+	index, ok := keyIndex(td.Table, tattr, "")
+	types := lsdy.KeyTypes(td.Table)
+	count := aws.Int64Value(td.Table.ItemCount)
+	if ok && (int64(len(refs)) <= count || count == 0) {
+		q := &lsdy.Query{
+			Table:      aws.StringValue(td.Table.TableName),
+			Index:      index,
+			Limit:      1,
+			Types:      types,
+			Projection: []string{tattr},
+			Page:       collect,
+		}
+
+		for _, r := range refs {
+			if r.typ == types[tattr] {
+				q.PK = append(q.PK, tattr+":"+r.val)
+			}
+		}
+
+		_, err = q.Run(svc)
+	} else {
+		_, err = (&lsdy.Scan{
+			Table:      aws.StringValue(td.Table.TableName),
+			Projection: []string{tattr},
+			Page:       collect,
+		}).Run(svc)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var orphans []*ref
+	var orphaned int
+	for k, r := range refs {
+		if !found[k] {
+			orphans = append(orphans, r)
+			orphaned += r.n
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].n != orphans[j].n {
+			return orphans[i].n > orphans[j].n
+		}
+
+		return orphans[i].val < orphans[j].val
+	})
+
+	for _, r := range orphans {
+		fmt.Printf("%v  %6d refs  first: %v\n", r.val, r.n, r.first)
+	}
+
+	log.Printf("%v: %v items, %v without %v, %v invalid; %v distinct references, %v orphans (in %v references)\n",
+		reffrom, items, without, fattr, invalid, len(refs), len(orphans), orphaned)
+
+	if len(orphans) > 0 {
+		return &codeError{exitInvalid, fmt.Errorf("%v orphan references in %v", len(orphans), reffrom)}
+	}
+
+	return nil
+}
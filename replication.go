@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	canary   []string
+	lagwait  time.Duration
+	lagevery time.Duration
+
+	replLagCmd = &cobra.Command{
+		Use:   "replication-lag <table> --canary <attr:value> [flags]",
+		Short: "write a canary item, and report how long it takes to show up in each replica region",
+		Long: `Write a canary item (with the --canary key, which should be reserved for it) to
+the global table in --region, then read it in each of the table's replica regions
+every --every until the write is seen, and print the replication lag of each
+region, i.e. the time from the write's response to the first read (strongly
+consistent, in the replica) that returns it. The lag includes up to --every, and
+the round trip of a read (printed along), so it's an upper bound.
+
+  lsdy replication-lag mytable --region us-east-1 --canary pk:_lsdy_canary
+
+For tables with a sort key, add it as a second --canary, i.e. 'sk:0'. The canary
+item is overwritten by each run, and left in the table. Only global tables of
+version 2019.11.21 (with Replicas in their description) are supported. The exit
+status is 1 if a region doesn't see the write within --wait.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               replLagQueryCmd,
+	}
+)
+
+// replLag is the result of polling a replica region.
+type replLag struct {
+	region string
+	lag    time.Duration // 0 if not seen
+	rtt    time.Duration // of the last read
+	err    error
+}
+
+// pollReplica reads the canary item in a replica region until its token is
+// token, from written, up to lagwait.
+func pollReplica(svc *dynamodb.DynamoDB, in *dynamodb.GetItemInput, token string, written time.Time) replLag {
+	var res replLag
+	for {
+		start := time.Now()
+		out, err := svc.GetItem(in)
+		res.rtt = time.Since(start)
+		if err != nil {
+			res.err = err
+			return res
+		}
+
+		if v, ok := out.Item["lsdy_canary"]; ok && aws.StringValue(v.S) == token {
+			res.lag = time.Since(written)
+			return res
+		}
+
+		if time.Since(written) > lagwait {
+			return res
+		}
+
+		time.Sleep(lagevery)
+	}
+}
+
+func replLagQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	log.SetFlags(0)
+	switch {
+	case len(canary) == 0:
+		return usageErrorf("--canary cannot be empty")
+	case lagevery <= 0:
+		return usageErrorf("invalid --every value: %v", lagevery)
+	}
+
+	table := aws.StringValue(t.TableName)
+	home := aws.StringValue(svc.Config.Region) // i.e. from the profile
+	var regions []string
+	for _, v := range t.Replicas {
+		if r := aws.StringValue(v.RegionName); r != home {
+			regions = append(regions, r)
+		}
+	}
+
+	if len(regions) == 0 {
+		return fmt.Errorf("%v: no replicas in other regions (not a global table, or version 2017.11.29)", table)
+	}
+
+	types := lsdy.KeyTypes(t)
+	key := make(map[string]*dynamodb.AttributeValue)
+	for _, v := range canary {
+		sp := strings.SplitN(v, ":", 2)
+		if len(sp) != 2 || sp[0] == "" {
+			return usageErrorf("invalid --canary format: %v", v)
+		}
+
+		av, err := lsdy.KeyValue(types[sp[0]], sp[1])
+		if err != nil {
+			return usageError(err)
+		}
+
+		key[sp[0]] = av
+	}
+
+	for _, k := range t.KeySchema {
+		if _, ok := key[aws.StringValue(k.AttributeName)]; !ok {
+			return usageErrorf("--canary is missing the key attribute %v", aws.StringValue(k.AttributeName))
+		}
+	}
+
+	now := time.Now()
+	token := fmt.Sprintf("%v-%v", now.UnixNano(), home)
+	item := map[string]*dynamodb.AttributeValue{
+		"lsdy_canary":  {S: aws.String(token)},
+		"lsdy_written": {S: aws.String(now.UTC().Format(time.RFC3339Nano))},
+	}
+
+	for k, v := range key {
+		item[k] = v
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{TableName: t.TableName, Item: item})
+	if err != nil {
+		return err
+	}
+
+	written := time.Now()
+	sess, cnfs, err := newSession()
+	if err != nil {
+		return err
+	}
+
+	in := &dynamodb.GetItemInput{
+		TableName:      t.TableName,
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	}
+
+	res := make([]replLag, len(regions))
+	var wg sync.WaitGroup
+	for i, r := range regions {
+		cfg := append([]*aws.Config{}, cnfs...)
+		rsvc := dynamodb.New(sess, append(cfg, &aws.Config{Region: aws.String(r)})...)
+		wg.Add(1)
+		go func(i int, r string) {
+			defer wg.Done()
+			res[i] = pollReplica(rsvc, in, token, written)
+			res[i].region = r
+		}(i, r)
+	}
+
+	wg.Wait()
+	var late []string
+	for _, v := range res {
+		switch {
+		case v.err != nil:
+			fmt.Printf("%-16v  error: %v\n", v.region, v.err)
+			late = append(late, v.region)
+		case v.lag == 0:
+			fmt.Printf("%-16v  not replicated after %v\n", v.region, lagwait)
+			late = append(late, v.region)
+		default:
+			fmt.Printf("%-16v  lag %8v  (read rtt %v)\n", v.region, v.lag.Round(time.Millisecond), v.rtt.Round(time.Millisecond))
+		}
+	}
+
+	if len(late) > 0 {
+		return fmt.Errorf("%v: the write in %v wasn't read in: %v", table, home, strings.Join(late, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+// rowsink, if set, receives the output rows of each run, i.e. for 'lsdy daemon'
+// and 'lsdy serve'. full returns the item of a row as displayed by --detail.
+var rowsink func(rows []lsdy.Row, full func(lsdy.Row) map[string]interface{}) error
+
+// newPipeline returns the row pipeline of the display flags, with the cells fit
+// in widths. The columns of --keys-only, and the '@keys' of --column-order depend
+// on the table, and are set by run.
+func newPipeline(cmd *cobra.Command, widths *colWidths) (*lsdy.Pipeline, error) {
+	switch binmode {
+	case "base64", "hex", "hexdump", "size":
+	default:
+		return nil, usageErrorf("invalid --binary value: %v", binmode)
+	}
+
+	p := &lsdy.Pipeline{
+		Attrs:        incols,
+		NoSort:       nosort,
+		Rename:       make(map[string]string),
+		Explode:      explattr,
+		Flatten:      flat,
+		FlattenDepth: flatlvl,
+		Format:       lsdy.Format{SetSep: setsep, Binary: binmode},
+		Decode:       b64dec,
+		Contains:     contains,
+		Hashes:       make(map[string]*lsdy.Hash),
+		Masks:        make(map[string]*lsdy.Mask),
+		Width:        widths.get,
+		CSVStrict:    csvstrct,
+		Dedupe:       cmd.Flags().Changed("dedupe"),
+		SortBy:       lsdy.ParseSortKeys(sortby),
+		Skip:         skip,
+	}
+
+	// With --wrap, we do our own wrapping.
+	if widths.perColumn() || wrap {
+		p.Shorten = shorten
+	}
+
+	if len(dedupe) != 1 || dedupe[0] != "*" { // all columns otherwise
+		p.DedupeBy = dedupe
+	}
+
+	var err error
+	switch {
+	case top != "" && bottom != "":
+		return nil, usageErrorf("--top and --bottom are mutually exclusive")
+	case top != "":
+		p.Top, err = lsdy.ParseTop(top, true)
+		if err != nil {
+			return nil, usageErrorf("invalid --top: %v", err)
+		}
+	case bottom != "":
+		p.Top, err = lsdy.ParseTop(bottom, false)
+		if err != nil {
+			return nil, usageErrorf("invalid --bottom: %v", err)
+		}
+	}
+
+	for _, v := range xforms {
+		spec, err := lsdy.ParseTransform(v)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Transforms = append(p.Transforms, spec)
+	}
+
+	for _, v := range protos {
+		spec, err := newProtoTransform(v)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Transforms = append(p.Transforms, spec)
+	}
+
+	for _, v := range masks {
+		spec, err := parseMask(v)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Masks[spec.Attr] = spec
+	}
+
+	for _, v := range hashf {
+		spec, err := parseHash(v)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Hashes[spec.Attr] = spec
+	}
+
+	for _, v := range rename {
+		sp := strings.SplitN(v, "=", 2)
+		if len(sp) != 2 || sp[0] == "" || sp[1] == "" {
+			return nil, usageErrorf("invalid --rename format: %v", v)
+		}
+
+		p.Rename[sp[0]] = sp[1]
+	}
+
+	return p, nil
+}
+
+// prepareItems returns the items, as unmarshaled, with p's Prepare, and then the
+// --script (if sc is set) applied. The values of the --transform-exec commands
+// (execs) are set in p.Exec.
+func prepareItems(p *lsdy.Pipeline, sc *script, execs []*execSpec, m []map[string]interface{}) ([]map[string]interface{}, error) {
+	m = p.Prepare(m)
+	if sc != nil {
+		var err error
+		m, err = sc.Items(m)
+		if err != nil {
+			return nil, fmt.Errorf("script: %v", err)
+		}
+	}
+
+	// Values piped through external commands, per attribute. These are done
+	// upfront in batches, and applied before the other transforms.
+	var err error
+	p.Exec, err = execValues(execs, execbat, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// csvHeaders sets the csv columns of p from --csv-header, and returns their
+// headers (with '#' first for --rownum). hdrs are the headers of cols.
+func csvHeaders(p *lsdy.Pipeline, cols, hdrs []string) ([]string, error) {
+	idx, out, err := csvLayout(csvhdr, cols, hdrs)
+	if err != nil {
+		return nil, err
+	}
+
+	if rownum {
+		out = append([]string{"#"}, out...)
+	}
+
+	p.CSVCols = idx
+	return out, nil
+}
+
+// transformErrors sets p.OnError to warn of the first failed value of each
+// --transform (the value is kept as is). The returned func warns of the counts,
+// once the rows are done.
+func transformErrors(p *lsdy.Pipeline) func() {
+	xferrs := make(map[*lsdy.Transform]int)
+	p.OnError = func(t *lsdy.Transform, err error) {
+		if xferrs[t]++; xferrs[t] == 1 {
+			log.Printf("warning: --transform %v: %v (the value is displayed as is)\n", t.Attr, err)
+		}
+	}
+
+	return func() {
+		for _, t := range p.Transforms {
+			if n := xferrs[t]; n > 1 {
+				log.Printf("warning: --transform %v failed on %v values\n", t.Attr, n)
+			}
+		}
+	}
+}
+
+// pinned returns the --column-order columns, with '@keys' as the table's key
+// attributes.
+func pinned(pklbl, sklbl string) []string {
+	var out []string
+	for _, v := range colorder {
+		if v == "@keys" {
+			out = append(out, pklbl)
+			if sklbl != "" {
+				out = append(out, sklbl)
+			}
+
+			continue
+		}
+
+		out = append(out, v)
+	}
+
+	return out
+}
+
+// csvLayout returns the csv columns (their indexes in cols, -1 if not there) and
+// headers, from --csv-header, fmt: <attr[=label]>, or all the columns (with the
+// headers of the table) if not set.
+func csvLayout(spec, cols, hdrs []string) ([]int, []string, error) {
+	if len(spec) == 0 {
+		idx := make([]int, len(cols))
+		for i := range cols {
+			idx[i] = i
+		}
+
+		return idx, hdrs, nil
+	}
+
+	var idx []int
+	var labels []string
+	for _, v := range spec {
+		sp := strings.SplitN(v, "=", 2)
+		if sp[0] == "" || (len(sp) == 2 && sp[1] == "") {
+			return nil, nil, usageErrorf("invalid --csv-header format: %v", v)
+		}
+
+		i := -1
+		for j, c := range cols {
+			if c == sp[0] {
+				i = j
+			}
+		}
+
+		idx = append(idx, i)
+		labels = append(labels, sp[len(sp)-1])
+	}
+
+	return idx, labels, nil
+}
+
+// openCSV creates the csv file, or opens it for appending (if appnd), along with
+// its header row, nil if the file is new, or empty.
+func openCSV(file string, appnd bool) (*os.File, []string, error) {
+	if !appnd {
+		f, err := os.Create(file)
+		return f, nil, err
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hdr, err := csv.NewReader(f).Read()
+	switch {
+	case err == io.EOF:
+		return f, nil, nil
+	case err != nil:
+		f.Close()
+		return nil, nil, fmt.Errorf("%v: %v", file, err)
+	}
+
+	return f, hdr, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	starjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+)
+
+// script wraps a Starlark file that defines 'transform(item)', which is called for
+// every item (a dict). It can return the (modified) item, a new dict, or None to
+// drop the item.
+type script struct {
+	thread *starlark.Thread
+	fn     starlark.Value
+}
+
+func newScript(file string) (*script, error) {
+	thread := &starlark.Thread{
+		Name:  "lsdy",
+		Print: func(_ *starlark.Thread, msg string) { fmt.Fprintln(os.Stderr, msg) },
+	}
+
+	predeclared := starlark.StringDict{"json": starjson.Module}
+	globals, err := starlark.ExecFile(thread, file, nil, predeclared)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := globals["transform"]
+	if !ok {
+		return nil, fmt.Errorf("%v: transform(item) is not defined", file)
+	}
+
+	if _, ok := fn.(starlark.Callable); !ok {
+		return nil, fmt.Errorf("%v: transform is not a function", file)
+	}
+
+	return &script{thread: thread, fn: fn}, nil
+}
+
+// Items calls Run on each of items, and returns the ones kept.
+func (s *script) Items(items []map[string]interface{}) ([]map[string]interface{}, error) {
+	var kept []map[string]interface{}
+	for _, v := range items {
+		item, err := s.Run(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if item != nil {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept, nil
+}
+
+// Run calls transform(item). A nil return value means the item is dropped.
+func (s *script) Run(item map[string]interface{}) (map[string]interface{}, error) {
+	in, err := toStarlark(item)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := starlark.Call(s.thread, s.fn, starlark.Tuple{in}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if out == starlark.None {
+		return nil, nil
+	}
+
+	if _, ok := out.(*starlark.Dict); !ok {
+		return nil, fmt.Errorf("transform: expecting dict or None, got %v", out.Type())
+	}
+
+	v, err := fromStarlark(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(map[string]interface{}), nil
+}
+
+func toStarlark(v interface{}) (starlark.Value, error) {
+	switch t := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(t), nil
+	case string:
+		return starlark.String(t), nil
+	case []byte:
+		return starlark.Bytes(t), nil
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < 1<<53 {
+			return starlark.MakeInt64(int64(t)), nil
+		}
+
+		return starlark.Float(t), nil
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+
+		f, err := t.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		return starlark.Float(f), nil
+	case []interface{}:
+		var elems []starlark.Value
+		for _, e := range t {
+			sv, err := toStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+
+			elems = append(elems, sv)
+		}
+
+		return starlark.NewList(elems), nil
+	case []string:
+		var elems []starlark.Value
+		for _, e := range t {
+			elems = append(elems, starlark.String(e))
+		}
+
+		return starlark.NewList(elems), nil
+	case []float64:
+		var elems []starlark.Value
+		for _, e := range t {
+			elems = append(elems, starlark.Float(e))
+		}
+
+		return starlark.NewList(elems), nil
+	case [][]byte:
+		var elems []starlark.Value
+		for _, e := range t {
+			elems = append(elems, starlark.Bytes(e))
+		}
+
+		return starlark.NewList(elems), nil
+	case map[string]interface{}:
+		d := starlark.NewDict(len(t))
+		for k, e := range t {
+			sv, err := toStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+
+			d.SetKey(starlark.String(k), sv)
+		}
+
+		return d, nil
+	default:
+		return starlark.String(fmt.Sprintf("%v", t)), nil
+	}
+}
+
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch t := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(t), nil
+	case starlark.String:
+		return string(t), nil
+	case starlark.Bytes:
+		return []byte(t), nil
+	case starlark.Int:
+		// Integers are kept exact, as json numbers, like the unmarshaled ones.
+		return json.Number(t.String()), nil
+	case starlark.Float:
+		return float64(t), nil
+	case *starlark.List:
+		var out []interface{}
+		for i := 0; i < t.Len(); i++ {
+			e, err := fromStarlark(t.Index(i))
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, e)
+		}
+
+		return out, nil
+	case starlark.Tuple:
+		var out []interface{}
+		for _, e := range t {
+			ev, err := fromStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, ev)
+		}
+
+		return out, nil
+	case *starlark.Dict:
+		out := make(map[string]interface{})
+		for _, kv := range t.Items() {
+			k, ok := starlark.AsString(kv[0])
+			if !ok {
+				k = kv[0].String()
+			}
+
+			e, err := fromStarlark(kv[1])
+			if err != nil {
+				return nil, err
+			}
+
+			out[k] = e
+		}
+
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported starlark type: %v", v.Type())
+	}
+}
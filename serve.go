@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	svport   int
+	svtoken  string
+	svmetric bool
+
+	serveCmd = &cobra.Command{
+		Use:   "serve [flags]",
+		Short: "expose the saved queries as read-only json endpoints over http",
+		Long: `Expose the queries saved by 'lsdy save' as read-only json endpoints:
+
+  GET /queries         the names of the saved queries
+  GET /queries/<name>  run the query, i.e. {"query":...,"table":...,"rows":[...]}
+
+If --token (or LSDY_TOKEN) is set, requests need an 'Authorization: Bearer <token>'
+header. Flags in the command line (i.e. --region, --profile, --env) apply to all
+the queries. Queries that delete items or --watch are refused, and their --csv,
+--detail, and --summary outputs are ignored. Queries run one at a time.
+
+With --metrics, GET /metrics exports Prometheus gauges: the rows, fetched items,
+and consumed rcu of each saved query (all of them are run on each scrape), and
+the item count, size, and consumed capacity (from cloudwatch) of their tables.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               serveQueryCmd,
+	}
+)
+
+// server runs the saved queries for 'lsdy serve'. Since the flags are global, one
+// query runs at a time.
+type server struct {
+	mu   sync.Mutex
+	fs   *pflag.FlagSet
+	base map[string]bool // flags set in the command line
+}
+
+// reply writes v as the json response.
+func reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// auth checks the bearer token, if set.
+func (s *server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if svtoken != "" && subtle.ConstantTimeCompare([]byte(tok), []byte(svtoken)) != 1 {
+			reply(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// queryNames returns the names of the saved queries, sorted.
+func queryNames() ([]string, error) {
+	cfg, err := readConfig(cfgfile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	queries, _ := cfg["queries"].(map[string]interface{})
+	for k := range queries {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+var errRefused = errors.New("query deletes items, or uses --watch")
+
+// run runs a saved query, and returns its table, and rows (as displayed by
+// --detail). The caller holds s.mu.
+func (s *server) run(name string) (string, []map[string]interface{}, error) {
+	s.fs.VisitAll(func(f *pflag.Flag) {
+		if !s.base[f.Name] {
+			resetFlag(f) // the previous query's
+		}
+	})
+
+	table, err := applyQuery(s.fs, name, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if del || watch > 0 {
+		return table, nil, errRefused
+	}
+
+	quiet, csvf, details, summary = true, "", nil, ""
+	shcache.itemsKey, shcache.items = "", nil
+	lastrun = nil
+	rows := []map[string]interface{}{}
+	rowsink = func(out []lsdy.Row, full func(lsdy.Row) map[string]interface{}) error {
+		for _, r := range out {
+			rows = append(rows, full(r))
+		}
+
+		return nil
+	}
+
+	start := time.Now()
+	if err := run(rootCmd, []string{table}); err != nil {
+		log.Printf("query %v: %v\n", name, err)
+		return table, nil, err
+	}
+
+	log.Printf("query %v: %v rows (%v)\n", name, len(rows), time.Since(start).Round(time.Millisecond))
+	return table, rows, nil
+}
+
+func (s *server) list(w http.ResponseWriter, r *http.Request) {
+	names, err := queryNames()
+	if err != nil {
+		reply(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	reply(w, http.StatusOK, map[string]interface{}{"queries": names})
+}
+
+func (s *server) query(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, err := loadQuery(cfgfile, name); err != nil {
+		reply(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := time.Now()
+	table, rows, err := s.run(name)
+	switch {
+	case err == errRefused:
+		reply(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+	case err != nil:
+		reply(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	default:
+		reply(w, http.StatusOK, map[string]interface{}{
+			"query": name,
+			"table": table,
+			"time":  start.UTC(),
+			"rows":  rows,
+		})
+	}
+}
+
+func serveQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := cmdFlags(cmd)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() > 0 {
+		return usageErrorf("unexpected arguments: %v", fs.Args())
+	}
+
+	log.SetFlags(0)
+	if svtoken == "" {
+		svtoken = os.Getenv("LSDY_TOKEN")
+	}
+
+	if svtoken == "" {
+		log.Println("warning: no --token, anyone who can reach the port can run the saved queries")
+	}
+
+	s := &server{fs: fs, base: make(map[string]bool)}
+	fs.Visit(func(f *pflag.Flag) { s.base[f.Name] = true })
+	nohist = true
+	shcache = &shellCache{tables: make(map[string]*dynamodb.DescribeTableOutput)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /queries", s.auth(s.list))
+	mux.HandleFunc("GET /queries/{name}", s.auth(s.query))
+	if svmetric {
+		mux.HandleFunc("GET /metrics", s.auth(s.metrics))
+	}
+
+	srv := &http.Server{Addr: fmt.Sprintf(":%v", svport), Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	log.Printf("serving the queries in %v on :%v\n", cfgfile, svport)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
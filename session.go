@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// newService returns a new dynamodb client using the credentials/endpoint flags.
+func newService() (*dynamodb.DynamoDB, error) {
+	sess, cnfs, err := newSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamodb.New(sess, cnfs...), nil
+}
+
+// newSession returns the aws session, and the configs to pass to the clients,
+// using the credentials/endpoint flags. Within 'lsdy shell', the session (and
+// assumed role credentials) is reused as long as these flags don't change.
+func newSession() (*session.Session, []*aws.Config, error) {
+	ck := fmt.Sprint(region, key, secret, profile, rolearn, fips, dualstk, proxy, cabundle)
+	if shcache != nil && shcache.sessKey == ck {
+		return shcache.sess, shcache.cnfs, nil
+	}
+
+	hc, err := httpClient(proxy, cabundle)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &aws.Config{
+		Region:     aws.String(region),
+		HTTPClient: hc,
+	}
+
+	if fips {
+		cfg.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+
+	if dualstk {
+		cfg.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+
+	// Explicit (or environment) keys take precedence over the profile.
+	var sess *session.Session
+	if profile != "" && key == "" {
+		sess, _ = session.NewSessionWithOptions(session.Options{
+			Config:            *cfg,
+			Profile:           profile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+	} else {
+		cfg.Credentials = credentials.NewStaticCredentials(key, secret, "")
+		sess, _ = session.NewSession(cfg)
+	}
+
+	var cnfs []*aws.Config
+	if rolearn != "" {
+		cnfs = append(cnfs, &aws.Config{Credentials: stscreds.NewCredentials(sess, rolearn)})
+	}
+
+	if shcache != nil {
+		shcache.sessKey, shcache.sess, shcache.cnfs = ck, sess, cnfs
+	}
+
+	return sess, cnfs, nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var shellCmd = &cobra.Command{
+	Use:   "shell <table> [flags]",
+	Short: "interactive prompt to adjust the flags and re-run queries against a table",
+	Long: `Interactive prompt to adjust the flags and re-run queries against a table. The
+aws session and the table description are reused across runs, and so are the
+fetched items, as long as the table, --pk, --sk, and --limit don't change.
+
+Type flags (i.e. '--pk id:ID0001 --attr id,status') to change them and re-run;
+flags typed again replace their previous values. Other commands:
+
+  run          fetch the items again and display them
+  next, prev   display the next/previous page of rows
+  page <n>     set the number of rows per page, 0 means all (default 20)
+  unset <flag> reset flags to their default values
+  reset        reset all flags to their default values
+  show         print the current query as a command line
+  refresh      forget the cached session, table description, and items
+  help         print this help
+  quit, exit   exit the shell (or Ctrl-D)`,
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	RunE:               shellQueryCmd,
+}
+
+// shellCache keeps state across the runs of 'lsdy shell' (and 'lsdy tail'). It
+// is nil outside these.
+type shellCache struct {
+	sessKey string // see newService
+	sess    *session.Session
+	cnfs    []*aws.Config
+
+	tables   map[string]*dynamodb.DescribeTableOutput
+	itemsKey string
+	items    []map[string]*dynamodb.AttributeValue
+	feed     []map[string]*dynamodb.AttributeValue // if set, displayed instead of fetching
+
+	pagesz int // rows per page, 0 means all
+	offset int
+}
+
+var shcache *shellCache
+
+// describeTable describes table, or returns the cached description within the
+// shell.
+func describeTable(svc *dynamodb.DynamoDB, table string) (*dynamodb.DescribeTableOutput, error) {
+	if shcache != nil {
+		if t, ok := shcache.tables[table]; ok {
+			return t, nil
+		}
+	}
+
+	t, err := svc.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err == nil && shcache != nil {
+		shcache.tables[table] = t
+	}
+
+	return t, err
+}
+
+// page returns the current page of rows.
+func (c *shellCache) page(rows []lsdy.Row) []lsdy.Row {
+	if c.pagesz <= 0 || len(rows) == 0 {
+		return rows
+	}
+
+	if c.offset >= len(rows) {
+		c.offset = (len(rows) - 1) / c.pagesz * c.pagesz
+	}
+
+	end := c.offset + c.pagesz
+	if end > len(rows) {
+		end = len(rows)
+	}
+
+	log.Printf("rows %v-%v of %v\n", c.offset+1, end, len(rows))
+	return rows[c.offset:end]
+}
+
+// splitArgs splits a line into words like a shell would, honoring single and
+// double quotes, and backslash escapes outside single quotes.
+func splitArgs(line string) ([]string, error) {
+	var out []string
+	var word strings.Builder
+	var quote rune
+	inword, escaped := false, false
+	for _, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inword = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inword = c, true
+		case c == ' ' || c == '\t':
+			if inword {
+				out = append(out, word.String())
+				word.Reset()
+				inword = false
+			}
+		default:
+			word.WriteRune(c)
+			inword = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+
+	if inword {
+		out = append(out, word.String())
+	}
+
+	return out, nil
+}
+
+// resetFlag sets f back to its default value.
+func resetFlag(f *pflag.Flag) {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		sv.Replace(nil)
+	} else {
+		f.Value.Set(f.DefValue)
+	}
+
+	f.Changed = false
+}
+
+func shellQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := rootCmd.Flags()
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 1 {
+		return usageErrorf("expecting <table>")
+	}
+
+	log.SetFlags(0)
+	table := fs.Arg(0)
+	shcache = &shellCache{
+		tables: make(map[string]*dynamodb.DescribeTableOutput),
+		pagesz: 20,
+	}
+
+	runq := func() {
+		if err := run(rootCmd, []string{table}); err != nil {
+			log.Println(err)
+		}
+	}
+
+	runq()
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "%v> ", table)
+		if !in.Scan() {
+			fmt.Fprintln(os.Stderr, "")
+			return in.Err()
+		}
+
+		words, err := splitArgs(in.Text())
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if len(words) == 0 {
+			continue
+		}
+
+		switch words[0] {
+		case "quit", "exit":
+			return nil
+		case "help":
+			fmt.Fprintln(os.Stderr, cmd.Long)
+		case "run":
+			shcache.itemsKey, shcache.items, shcache.offset = "", nil, 0
+			runq()
+		case "next":
+			shcache.offset += shcache.pagesz
+			runq()
+		case "prev":
+			shcache.offset -= shcache.pagesz
+			if shcache.offset < 0 {
+				shcache.offset = 0
+			}
+
+			runq()
+		case "page":
+			n, err := strconv.Atoi(strings.Join(words[1:], ""))
+			if err != nil || n < 0 {
+				log.Println("usage: page <n>")
+				continue
+			}
+
+			shcache.pagesz, shcache.offset = n, 0
+			runq()
+		case "unset":
+			for _, name := range words[1:] {
+				f := fs.Lookup(strings.TrimLeft(name, "-"))
+				if f == nil {
+					log.Printf("unknown flag: %v\n", name)
+					continue
+				}
+
+				resetFlag(f)
+			}
+		case "reset":
+			fs.Visit(resetFlag)
+		case "show":
+			fmt.Println(histEntry{Table: table, Flags: changedFlags(fs, "config")}.cmdline())
+		case "refresh":
+			shcache.sessKey, shcache.itemsKey, shcache.items = "", "", nil
+			shcache.tables = make(map[string]*dynamodb.DescribeTableOutput)
+		default:
+			if !strings.HasPrefix(words[0], "-") {
+				log.Printf("unknown command: %v (see 'help')\n", words[0])
+				continue
+			}
+
+			// Flags typed again replace their previous values.
+			for _, w := range words {
+				if !strings.HasPrefix(w, "--") {
+					continue
+				}
+
+				name := strings.SplitN(strings.TrimPrefix(w, "--"), "=", 2)[0]
+				if f := fs.Lookup(name); f != nil {
+					resetFlag(f)
+				}
+			}
+
+			if err := fs.Parse(words); err != nil {
+				log.Println(err)
+				continue
+			}
+
+			shcache.offset = 0
+			runq()
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snaptag string
+
+	snapshotCmd = &cobra.Command{
+		Use:   "snapshot <table> --tag <name> [flags]",
+		Short: "store the items of a query under a tag, see 'lsdy diff-snapshots'",
+		Long: `Run a query (all the flags apply) and store the fetched items under a tag, i.e.
+before and after a maintenance job, to compare them with 'lsdy diff-snapshots'.
+A snapshot with the same tag is replaced.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               snapshotQueryCmd,
+	}
+
+	diffSnapCmd = &cobra.Command{
+		Use:          "diff-snapshots <tag> <tag>",
+		Short:        "list the items added, removed, or changed (attribute by attribute) between two snapshots",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE:         diffSnapshotsCmd,
+	}
+)
+
+var snapTag = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// snapshotPath returns the file of a snapshot tag, see stateDir.
+func snapshotPath(tag string) string {
+	return filepath.Join(stateDir(), "snapshots", tag+".json")
+}
+
+// readSnapshot returns the snapshot stored under tag.
+func readSnapshot(tag string) (*cacheEntry, error) {
+	var e cacheEntry
+	if err := readJSON(snapshotPath(tag), &e); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("snapshot not found: %v", tag)
+		}
+
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// tableKeys returns the names of the table's key attributes, hash key first.
+func tableKeys(t *dynamodb.DescribeTableOutput) []string {
+	var keys []string
+	for _, v := range t.Table.KeySchema {
+		if *v.KeyType == "HASH" {
+			keys = append([]string{*v.AttributeName}, keys...)
+		} else {
+			keys = append(keys, *v.AttributeName)
+		}
+	}
+
+	return keys
+}
+
+// snapshotItems returns the items of a snapshot by their key, i.e. 'id=1, sk=a'.
+func snapshotItems(e *cacheEntry, keys []string) (map[string]map[string]interface{}, error) {
+	m, err := lsdy.UnmarshalItems(e.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]map[string]interface{})
+	for _, item := range m {
+		var parts []string
+		for _, k := range keys {
+			parts = append(parts, fmt.Sprintf("%v=%v", k, item[k]))
+		}
+
+		out[strings.Join(parts, ", ")] = item
+	}
+
+	return out, nil
+}
+
+func snapshotQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := cmdFlags(cmd)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 1 {
+		return usageErrorf("expecting <table>")
+	}
+
+	if !snapTag.MatchString(snaptag) {
+		return usageErrorf("invalid --tag format: %v", snaptag)
+	}
+
+	switch {
+	case del:
+		return usageErrorf("--delete is not supported with snapshot")
+	case watch > 0:
+		return usageErrorf("--watch is not supported with snapshot")
+	}
+
+	return run(rootCmd, []string{fs.Arg(0)})
+}
+
+func diffSnapshotsCmd(cmd *cobra.Command, args []string) error {
+	log.SetFlags(0)
+	var snaps []*cacheEntry
+	for _, tag := range args {
+		e, err := readSnapshot(tag)
+		if err != nil {
+			return err
+		}
+
+		snaps = append(snaps, e)
+	}
+
+	keys := tableKeys(snaps[0].Table)
+	if !reflect.DeepEqual(keys, tableKeys(snaps[1].Table)) {
+		return fmt.Errorf("snapshots have different keys: %v, %v", keys, tableKeys(snaps[1].Table))
+	}
+
+	before, err := snapshotItems(snaps[0], keys)
+	if err != nil {
+		return err
+	}
+
+	after, err := snapshotItems(snaps[1], keys)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for k := range before {
+		ids = append(ids, k)
+	}
+
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			ids = append(ids, k)
+		}
+	}
+
+	sort.Strings(ids)
+
+	// Values are displayed as json, so that a missing attribute (blank) differs
+	// from an empty string ("").
+	val := func(item map[string]interface{}, attr string) string {
+		v, ok := item[attr]
+		if !ok {
+			return ""
+		}
+
+		s, _ := lsdy.JSON(v)
+		return s
+	}
+
+	table := (&lsdy.Render{}).Table(os.Stdout)
+	table.SetHeader([]string{"", "key", "attribute", args[0], args[1]})
+	var added, removed, changed int
+	for _, id := range ids {
+		b, inb := before[id]
+		a, ina := after[id]
+		switch {
+		case !inb:
+			added++
+			table.Append([]string{"+", id, "", "", ""})
+		case !ina:
+			removed++
+			table.Append([]string{"-", id, "", "", ""})
+		default:
+			var attrs []string
+			for k := range b {
+				attrs = append(attrs, k)
+			}
+
+			for k := range a {
+				if _, ok := b[k]; !ok {
+					attrs = append(attrs, k)
+				}
+			}
+
+			sort.Strings(attrs)
+			diff := false
+			for _, k := range attrs {
+				bv, inb := b[k]
+				av, ina := a[k]
+				if inb == ina && reflect.DeepEqual(bv, av) {
+					continue
+				}
+
+				diff = true
+				table.Append([]string{"~", id, k, val(b, k), val(a, k)})
+			}
+
+			if diff {
+				changed++
+			}
+		}
+	}
+
+	if added+removed+changed > 0 {
+		table.Render()
+	}
+
+	log.Printf("%v (%v): %v items, %v (%v): %v items; %v added, %v removed, %v changed\n",
+		args[0], snaps[0].Time.Local().Format("2006-01-02 15:04:05"), len(before),
+		args[1], snaps[1].Time.Local().Format("2006-01-02 15:04:05"), len(after),
+		added, removed, changed)
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// runStats is the --summary output.
+type runStats struct {
+	Fetched   int     `json:"fetched"` // items returned by dynamodb
+	Scanned   int     `json:"scanned"` // items read by dynamodb, before the filter expression
+	Rows      int     `json:"rows"`    // rows displayed, after filters
+	Pages     int     `json:"pages"`
+	RCU       float64 `json:"consumed_rcu"`
+	ElapsedMs int64   `json:"elapsed_ms"`
+	Deleted   int     `json:"deleted"`
+	Invalid   int     `json:"invalid"`   // items that failed --validate
+	Throttles int     `json:"throttles"` // throttled attempts
+	Retries   int     `json:"retries"`
+
+	start   time.Time
+	table   string      // with the table_prefix
+	window  []rcuSample // consumed capacity of the last rcuWindow
+	lastlog time.Time   // of the last throttling message
+}
+
+// rcuSample is the consumed capacity of a page.
+type rcuSample struct {
+	t   time.Time
+	rcu float64
+}
+
+// rcuWindow is the period over which the effective RCU/s is computed.
+const rcuWindow = 5 * time.Second
+
+// lastrun is the stats of the last (complete) run, i.e. for 'lsdy serve --metrics'.
+var lastrun *runStats
+
+func newRunStats() *runStats { return &runStats{start: time.Now()} }
+
+// instrument counts the Query/Scan pages sent through svc, along with their
+// consumed capacity, and the throttled attempts. pkg/lsdy builds its own
+// inputs, so we ask for the consumed capacity before the request is built.
+func (s *runStats) instrument(svc *dynamodb.DynamoDB) {
+	svc.Handlers.Build.PushFront(func(r *request.Request) {
+		switch in := r.Params.(type) {
+		case *dynamodb.QueryInput:
+			in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		case *dynamodb.ScanInput:
+			in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		}
+	})
+
+	svc.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error != nil {
+			return
+		}
+
+		var cc *dynamodb.ConsumedCapacity
+		switch out := r.Data.(type) {
+		case *dynamodb.QueryOutput:
+			cc = out.ConsumedCapacity
+			s.Scanned += int(aws.Int64Value(out.ScannedCount))
+		case *dynamodb.ScanOutput:
+			cc = out.ConsumedCapacity
+			s.Scanned += int(aws.Int64Value(out.ScannedCount))
+		default:
+			return
+		}
+
+		s.Pages++
+		if cc != nil && cc.CapacityUnits != nil {
+			s.RCU += *cc.CapacityUnits
+			s.window = append(s.window, rcuSample{time.Now(), *cc.CapacityUnits})
+		}
+	})
+
+	// Each throttled (or otherwise failed) attempt, including the ones retried by
+	// the sdk.
+	svc.Handlers.CompleteAttempt.PushBack(func(r *request.Request) {
+		if r.RetryCount > 0 {
+			s.Retries++
+		}
+
+		if r.Error == nil || !request.IsErrorThrottle(r.Error) {
+			return
+		}
+
+		s.Throttles++
+		if time.Since(s.lastlog) >= time.Second {
+			s.lastlog = time.Now()
+			log.Printf("throttled: %v (%v throttles, %v retries so far, %.1f RCU/s)\n",
+				r.Operation.Name, s.Throttles, s.Retries, s.rate())
+		}
+	})
+}
+
+// rate returns the effective RCU/s over the last rcuWindow.
+func (s *runStats) rate() float64 {
+	cut := time.Now().Add(-rcuWindow)
+	i := 0
+	for i < len(s.window) && s.window[i].t.Before(cut) {
+		i++
+	}
+
+	s.window = s.window[i:]
+	var sum float64
+	for _, v := range s.window {
+		sum += v.rcu
+	}
+
+	return sum / rcuWindow.Seconds()
+}
+
+// throttled logs the throttling of the run, if any.
+func (s *runStats) throttled() {
+	if s.Throttles == 0 {
+		return
+	}
+
+	el := time.Since(s.start).Seconds()
+	log.Printf("throttling: %v throttled requests, %v retries; %.1f RCU consumed, %.1f RCU/s on average\n",
+		s.Throttles, s.Retries, s.RCU, s.RCU/el)
+}
+
+// footer logs the rows, and the items scanned (and pages) to get them, and the
+// time it took, i.e. '128 items (342 scanned, 3 pages) in 1.8s'.
+func (s *runStats) footer(rows int) {
+	el := time.Since(s.start)
+	if el >= time.Second {
+		el = el.Round(100 * time.Millisecond)
+	} else {
+		el = el.Round(time.Millisecond)
+	}
+
+	if s.Pages == 0 { // i.e. --offline, --transact
+		log.Printf("%v items in %v\n", rows, el)
+		return
+	}
+
+	log.Printf("%v items (%v scanned, %v pages) in %v\n", rows, s.Scanned, s.Pages, el)
+}
+
+// write writes the summary as json to file, or to stderr if file is '-'.
+func (s *runStats) write(file string) error {
+	s.ElapsedMs = time.Since(s.start).Milliseconds()
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	b = append(b, '\n')
+	if file == "-" {
+		_, err = os.Stderr.Write(b)
+		return err
+	}
+
+	return os.WriteFile(file, b, 0644)
+}
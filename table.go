@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// colWidths is the parsed value of --maxlen, fmt: <n> for all columns, or
+// <attr=n[,attr=n...][,*=n]> for per-column widths.
+type colWidths struct {
+	def  int
+	cols map[string]int
+}
+
+func parseMaxlen(v string, def int) (*colWidths, error) {
+	w := &colWidths{def: def, cols: make(map[string]int)}
+	if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		if n <= 0 {
+			return nil, usageErrorf("invalid --maxlen width: %v", v)
+		}
+
+		w.def = n
+		return w, nil
+	}
+
+	for _, s := range strings.Split(v, ",") {
+		sp := strings.SplitN(strings.TrimSpace(s), "=", 2)
+		if len(sp) != 2 || sp[0] == "" {
+			return nil, usageErrorf("invalid --maxlen format: %v", v)
+		}
+
+		n, err := strconv.Atoi(sp[1])
+		if err != nil || n <= 0 {
+			return nil, usageErrorf("invalid --maxlen width: %v", s)
+		}
+
+		if sp[0] == "*" {
+			w.def = n
+			continue
+		}
+
+		w.cols[sp[0]] = n
+	}
+
+	return w, nil
+}
+
+// perColumn returns true if widths are set per column, in which case cells are
+// truncated to their column's width instead of wrapped at the global width.
+func (w *colWidths) perColumn() bool { return len(w.cols) > 0 }
+
+// get returns the width of column col.
+func (w *colWidths) get(col string) int {
+	if n, ok := w.cols[col]; ok {
+		return n
+	}
+
+	return w.def
+}
+
+// max returns the widest configured width.
+func (w *colWidths) max() int {
+	m := w.def
+	for _, n := range w.cols {
+		if n > m {
+			m = n
+		}
+	}
+
+	return m
+}
+
+// truncate shortens each line of v to at most n columns (display width, so that
+// fullwidth characters are accounted for).
+func truncate(v string, n int) string {
+	lines := strings.Split(v, "\n")
+	for i, l := range lines {
+		lines[i] = runewidth.Truncate(l, n, "")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// wrapCell breaks each line of v into lines of at most n columns (display width).
+// Unlike the table's own word wrapping, long words are broken as well.
+func wrapCell(v string, n int) string {
+	var out []string
+	for _, l := range strings.Split(v, "\n") {
+		var b strings.Builder
+		w := 0
+		for _, r := range l {
+			rw := runewidth.RuneWidth(r)
+			if w+rw > n && w > 0 {
+				out = append(out, b.String())
+				b.Reset()
+				w = 0
+			}
+
+			b.WriteRune(r)
+			w += rw
+		}
+
+		out = append(out, b.String())
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// shorten fits v in n columns, either by wrapping (--wrap) or truncating.
+func shorten(v string, n int) string {
+	if wrap {
+		return wrapCell(v, n)
+	}
+
+	return truncate(v, n)
+}
+
+// termWidth returns the width of the terminal attached to stdout, or $COLUMNS if
+// set, or 0 if unknown.
+func termWidth() int {
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+
+	n, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return n
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMaxlen(t *testing.T) {
+	for _, tc := range []struct {
+		v    string
+		def  int
+		cols map[string]int
+	}{
+		{"30", 30, nil},
+		{"payload=40,id=36", 10, map[string]int{"payload": 40, "id": 36}},
+		{"payload=40,*=20", 20, map[string]int{"payload": 40}},
+	} {
+		w, err := parseMaxlen(tc.v, 10)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.v, err)
+		}
+
+		if w.def != tc.def || len(w.cols) != len(tc.cols) {
+			t.Errorf("%v: got %v %v", tc.v, w.def, w.cols)
+		}
+
+		for k, n := range tc.cols {
+			if w.get(k) != n {
+				t.Errorf("%v: %v: got %v, want %v", tc.v, k, w.get(k), n)
+			}
+		}
+	}
+
+	for _, v := range []string{"0", "-5", "payload=0", "payload=-1", "*=-5", "payload", "=3", "x=y"} {
+		_, err := parseMaxlen(v, 10)
+		var ce *codeError
+		if !errors.As(err, &ce) || ce.code != exitUsage {
+			t.Errorf("%v: expecting a usage error, got %v", v, err)
+		}
+	}
+}
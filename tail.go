@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tailfrom string
+	tailuntl string
+	tailout  string
+	tailkin  bool
+	tailefo  string
+
+	tailCmd = &cobra.Command{
+		Use:   "tail <table> [flags]",
+		Short: "print the changes to a table (from its dynamodb stream) as they happen",
+		Long: `Print the changes to a table, read from its dynamodb stream, as they happen,
+until Ctrl-C. The stream has to be enabled on the table. If it's not, or with
+--kinesis, the changes are read from the table's kinesis data stream instead
+(optionally with enhanced fan-out, see --efo).
+
+Each change is displayed as an item with these additional attributes:
+
+  @event  INSERT, MODIFY, or REMOVE
+  @time   approximate time of the change
+  @old    for MODIFY, the previous values of the changed attributes
+
+The item is the new image, or the old image for REMOVE (or only the keys, if the
+stream's view type is KEYS_ONLY). All the display flags apply, i.e.
+
+  lsdy tail mytable --attr @time,@event,id,status,@old.status
+
+With --out, the change records are written to a file instead, one json object
+per line, i.e. to capture a window of changes for replay or audit:
+
+  {"table":"mytable","event":"MODIFY","time":"...","seq":"...",
+   "keys":{...},"new":{...},"old":{...}}
+
+This stops once the stream is read up to --until, which defaults to the time the
+command started if both --out and --from are set.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               tailQueryCmd,
+	}
+)
+
+// tailPoll is the interval between reads of the stream's shards. The stream
+// allows up to 5 reads per second per shard.
+const tailPoll = time.Second
+
+// changeSource is where 'lsdy tail' reads the change records from, either the
+// table's dynamodb stream (tailer), or its kinesis data stream (kinesisTailer).
+type changeSource interface {
+	// poll returns the records available since the last call.
+	poll(ctx context.Context) ([]*dynamodbstreams.Record, error)
+
+	// done returns true if the records up to --until have been read.
+	done() bool
+}
+
+// tailShard is the read state of a stream shard.
+type tailShard struct {
+	parent string
+	typ    string  // first iterator type
+	iter   *string // nil if not yet (or no longer) available
+	seq    string  // last sequence number read
+	done   bool
+	caught bool // last read returned nothing new, or reached tailer.until
+}
+
+// tailer reads the records of a stream, parent shards first.
+type tailer struct {
+	svc     *dynamodbstreams.DynamoDBStreams
+	arn     string
+	from    time.Time // zero means new records only
+	until   time.Time // zero means no end
+	shards  map[string]*tailShard
+	started bool
+}
+
+// discover adds the stream's shards that are not known yet. On the first call
+// without --from, only the open shards are read, starting from their tips.
+func (t *tailer) discover(ctx context.Context) error {
+	var start *string
+	for {
+		out, err := t.svc.DescribeStreamWithContext(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(t.arn),
+			ExclusiveStartShardId: start,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, s := range out.StreamDescription.Shards {
+			id := aws.StringValue(s.ShardId)
+			if _, ok := t.shards[id]; ok {
+				continue
+			}
+
+			ts := &tailShard{
+				parent: aws.StringValue(s.ParentShardId),
+				typ:    dynamodbstreams.ShardIteratorTypeTrimHorizon,
+			}
+
+			if !t.started && t.from.IsZero() {
+				ts.typ = dynamodbstreams.ShardIteratorTypeLatest
+				if s.SequenceNumberRange != nil && s.SequenceNumberRange.EndingSequenceNumber != nil {
+					ts.done = true // closed
+				}
+			}
+
+			t.shards[id] = ts
+		}
+
+		start = out.StreamDescription.LastEvaluatedShardId
+		if start == nil {
+			break
+		}
+	}
+
+	t.started = true
+	return nil
+}
+
+// poll reads the available records of the shards whose parents are done, sorted
+// by their approximate creation time.
+func (t *tailer) poll(ctx context.Context) ([]*dynamodbstreams.Record, error) {
+	var recs []*dynamodbstreams.Record
+	closed := false
+	for id, s := range t.shards {
+		if s.done {
+			continue
+		}
+
+		if p, ok := t.shards[s.parent]; ok && !p.done {
+			continue
+		}
+
+		if s.iter == nil {
+			in := &dynamodbstreams.GetShardIteratorInput{
+				StreamArn:         aws.String(t.arn),
+				ShardId:           aws.String(id),
+				ShardIteratorType: aws.String(s.typ),
+			}
+
+			if s.seq != "" {
+				in.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeAfterSequenceNumber)
+				in.SequenceNumber = aws.String(s.seq)
+			}
+
+			out, err := t.svc.GetShardIteratorWithContext(ctx, in)
+			if err != nil {
+				return recs, err
+			}
+
+			s.iter = out.ShardIterator
+		}
+
+		out, err := t.svc.GetRecordsWithContext(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: s.iter})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodbstreams.ErrCodeExpiredIteratorException {
+				s.iter, s.caught = nil, false // get a new one after s.seq on the next poll
+				continue
+			}
+
+			return recs, err
+		}
+
+		s.caught = len(out.Records) == 0
+		for _, r := range out.Records {
+			s.seq = aws.StringValue(r.Dynamodb.SequenceNumber)
+			at := aws.TimeValue(r.Dynamodb.ApproximateCreationDateTime)
+			if !t.until.IsZero() && !at.Before(t.until) {
+				s.caught = true
+				continue
+			}
+
+			if !t.from.IsZero() && at.Before(t.from) {
+				continue
+			}
+
+			recs = append(recs, r)
+		}
+
+		s.iter = out.NextShardIterator
+		if s.iter == nil {
+			s.done, closed = true, true
+		}
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		return aws.TimeValue(recs[i].Dynamodb.ApproximateCreationDateTime).Before(aws.TimeValue(recs[j].Dynamodb.ApproximateCreationDateTime))
+	})
+
+	if closed {
+		return recs, t.discover(ctx) // the closed shards' children
+	}
+
+	return recs, nil
+}
+
+// done returns true if the stream has been read up to t.until.
+func (t *tailer) done() bool {
+	if t.until.IsZero() || time.Now().Before(t.until) {
+		return false
+	}
+
+	for _, s := range t.shards {
+		if !s.done && !s.caught {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseTime parses the value of a --from/--until flag, either a time (RFC3339) or
+// a duration ago, i.e. '30m'.
+func parseTime(flag, v string) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, usageErrorf("invalid --%v format: %v", flag, v)
+	}
+
+	return t, nil
+}
+
+// recordItem returns the item to display for a stream record, see tailCmd.
+func recordItem(r *dynamodbstreams.Record) map[string]*dynamodb.AttributeValue {
+	d := r.Dynamodb
+	event := aws.StringValue(r.EventName)
+	img := d.NewImage
+	if event == dynamodbstreams.OperationTypeRemove || img == nil {
+		img = d.OldImage
+	}
+
+	if img == nil {
+		img = d.Keys
+	}
+
+	item := make(map[string]*dynamodb.AttributeValue)
+	for k, v := range img {
+		item[k] = v
+	}
+
+	item["@event"] = &dynamodb.AttributeValue{S: aws.String(event)}
+	if d.ApproximateCreationDateTime != nil {
+		item["@time"] = &dynamodb.AttributeValue{S: aws.String(d.ApproximateCreationDateTime.Local().Format(time.RFC3339))}
+	}
+
+	if event == dynamodbstreams.OperationTypeModify && d.OldImage != nil && d.NewImage != nil {
+		old := make(map[string]*dynamodb.AttributeValue)
+		for k, v := range d.OldImage {
+			if !reflect.DeepEqual(v, d.NewImage[k]) {
+				old[k] = v
+			}
+		}
+
+		for k := range d.NewImage {
+			if _, ok := d.OldImage[k]; !ok {
+				old[k] = &dynamodb.AttributeValue{NULL: aws.Bool(true)} // added
+			}
+		}
+
+		item["@old"] = &dynamodb.AttributeValue{M: old}
+	}
+
+	return item
+}
+
+// changeRecord is a line in the --out file.
+type changeRecord struct {
+	Table string                 `json:"table"`
+	Event string                 `json:"event"`
+	Time  time.Time              `json:"time"`
+	Seq   string                 `json:"seq"`
+	Keys  map[string]interface{} `json:"keys"`
+	New   map[string]interface{} `json:"new,omitempty"`
+	Old   map[string]interface{} `json:"old,omitempty"`
+}
+
+// writeRecords writes recs to w as change records, one json object per line.
+func writeRecords(w io.Writer, table string, recs []*dynamodbstreams.Record) error {
+	for _, r := range recs {
+		d := r.Dynamodb
+		cr := changeRecord{
+			Table: table,
+			Event: aws.StringValue(r.EventName),
+			Time:  aws.TimeValue(d.ApproximateCreationDateTime).UTC(),
+			Seq:   aws.StringValue(d.SequenceNumber),
+		}
+
+		for _, v := range []struct {
+			img map[string]*dynamodb.AttributeValue
+			out *map[string]interface{}
+		}{{d.Keys, &cr.Keys}, {d.NewImage, &cr.New}, {d.OldImage, &cr.Old}} {
+			if v.img == nil {
+				continue
+			}
+
+			if err := dynamodbattribute.UnmarshalMap(v.img, v.out); err != nil {
+				return err
+			}
+		}
+
+		line, err := lsdy.JSON(cr)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func tailQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := cmdFlags(cmd)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 1 {
+		return usageErrorf("expecting <table>")
+	}
+
+	switch {
+	case del:
+		return usageErrorf("--delete is not supported with tail")
+	case watch > 0:
+		return usageErrorf("--watch is not supported with tail")
+	}
+
+	log.SetFlags(0)
+	var prefix string
+	if cfgfile != "" {
+		var err error
+		prefix, err = loadConfig(rootCmd.Flags(), cfgfile, fs.Changed("config") || envname != "")
+		if err != nil {
+			return err
+		}
+	}
+
+	var from, until time.Time
+	if tailfrom != "" {
+		var err error
+		from, err = parseTime("from", tailfrom)
+		if err != nil {
+			return err
+		}
+
+		if tailout != "" {
+			until = time.Now()
+		}
+	}
+
+	if tailuntl != "" {
+		var err error
+		until, err = parseTime("until", tailuntl)
+		if err != nil {
+			return err
+		}
+	}
+
+	var out io.Writer
+	switch tailout {
+	case "":
+	case "-":
+		out = os.Stdout
+	default:
+		f, err := os.OpenFile(tailout, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		out = f
+	}
+
+	nohist = true
+	shcache = &shellCache{tables: make(map[string]*dynamodb.DescribeTableOutput)}
+	table := fs.Arg(0)
+	svc, err := newService()
+	if err != nil {
+		return err
+	}
+
+	desc, err := describeTable(svc, prefix+table)
+	if err != nil {
+		return err
+	}
+
+	sess, cnfs, err := newSession()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// The table's dynamodb stream is preferred, unless asked otherwise.
+	var src changeSource
+	var arn string
+	spec := desc.Table.StreamSpecification
+	switch {
+	case !tailkin && tailefo == "" && spec != nil && aws.BoolValue(spec.StreamEnabled):
+		t := &tailer{
+			svc:    dynamodbstreams.New(sess, cnfs...),
+			arn:    aws.StringValue(desc.Table.LatestStreamArn),
+			from:   from,
+			until:  until,
+			shards: make(map[string]*tailShard),
+		}
+
+		if err := t.discover(ctx); err != nil {
+			return err
+		}
+
+		src, arn = t, t.arn
+	default:
+		k, err := newKinesisTailer(ctx, svc, kinesis.New(sess, cnfs...), prefix+table, from, until)
+		if err != nil {
+			return err
+		}
+
+		defer k.close()
+		src, arn = k, k.arn
+	}
+
+	log.Printf("tailing %v (%v)\n", arn, strings.Join(os.Args, " "))
+	n := 0
+	defer func() {
+		if out != nil {
+			log.Printf("wrote %v change records\n", n)
+		}
+	}()
+
+	for {
+		recs, err := src.poll(ctx)
+		switch {
+		case out != nil:
+			if err := writeRecords(out, prefix+table, recs); err != nil {
+				return err
+			}
+
+			n += len(recs)
+		case len(recs) > 0:
+			shcache.feed = nil
+			for _, r := range recs {
+				shcache.feed = append(shcache.feed, recordItem(r))
+			}
+
+			if err := run(rootCmd, []string{table}); err != nil {
+				log.Println(err)
+			}
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if src.done() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(tailPoll):
+		}
+	}
+}
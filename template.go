@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+// tmplData is what --template is executed with, i.e.
+//
+//	{{range .Items}}{{.id}}: {{fmt .status}}
+//	{{end}}{{.Count}} items in {{.Table}}
+type tmplData struct {
+	Table string                   // with the table_prefix
+	Cols  []string                 // attributes of the columns, in order
+	Items []map[string]interface{} // full (untruncated) items, as masked/hashed
+	Count int
+}
+
+// templatesDir returns the location of the '--template @name' files,
+// --templates-dir, or the templates directory next to the default config file.
+func templatesDir() string {
+	if tmpldir != "" {
+		return tmpldir
+	}
+
+	cfg := configPath()
+	if cfg == "" {
+		return ""
+	}
+
+	return filepath.Join(filepath.Dir(cfg), "templates")
+}
+
+// loadTemplate parses --template, either inline, or '@name' for the name.tmpl
+// file in templatesDir.
+func loadTemplate(spec string) (*template.Template, error) {
+	text := spec
+	if strings.HasPrefix(spec, "@") {
+		file := filepath.Join(templatesDir(), spec[1:]+".tmpl")
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, usageErrorf("--template: %v", err)
+		}
+
+		text = string(b)
+	}
+
+	t, err := template.New(spec).Funcs(template.FuncMap{
+		"fmt":  fmtval,
+		"json": lsdy.JSON,
+		"join": strings.Join,
+	}).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, usageErrorf("invalid --template: %v", err)
+	}
+
+	return t, nil
+}
+
+// completeTemplates completes the names of the templates in templatesDir, for
+// --template.
+func completeTemplates(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	files, err := filepath.Glob(filepath.Join(templatesDir(), "*.tmpl"))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, f := range files {
+		name := fmt.Sprintf("@%v", strings.TrimSuffix(filepath.Base(f), ".tmpl"))
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
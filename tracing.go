@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is a no-op unless --otlp is set.
+var tracer = otel.Tracer("github.com/flowerinthenight/lsdy")
+
+// setupTracing exports spans to an OTLP/HTTP collector at endpoint, i.e.
+// 'http://localhost:4318'. The returned func flushes the pending spans.
+func setupTracing(endpoint string) (func(), error) {
+	exp, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "lsdy"))),
+	)
+
+	otel.SetTracerProvider(tp)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tp.Shutdown(ctx)
+	}, nil
+}
+
+// traceCalls creates a client span, under parent, for each api call sent through
+// svc (including the ones made by pkg/lsdy).
+func traceCalls(parent context.Context, svc *dynamodb.DynamoDB) {
+	var mu sync.Mutex
+	spans := make(map[*request.Request]trace.Span)
+	svc.Handlers.Build.PushFront(func(r *request.Request) {
+		_, span := tracer.Start(parent, "dynamodb."+r.Operation.Name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "dynamodb"),
+				attribute.String("rpc.method", r.Operation.Name),
+			),
+		)
+
+		mu.Lock()
+		spans[r] = span
+		mu.Unlock()
+	})
+
+	svc.Handlers.Complete.PushBack(func(r *request.Request) {
+		mu.Lock()
+		span, ok := spans[r]
+		delete(spans, r)
+		mu.Unlock()
+		if !ok {
+			return
+		}
+
+		defer span.End()
+		span.SetAttributes(attribute.Int("aws.retry_count", r.RetryCount))
+		if r.Error != nil {
+			span.RecordError(r.Error)
+			span.SetStatus(codes.Error, r.Error.Error())
+			return
+		}
+
+		switch out := r.Data.(type) {
+		case *dynamodb.QueryOutput:
+			span.SetAttributes(
+				attribute.Int64("aws.dynamodb.count", aws.Int64Value(out.Count)),
+				attribute.Int64("aws.dynamodb.scanned_count", aws.Int64Value(out.ScannedCount)),
+				attribute.Bool("aws.dynamodb.more_pages", len(out.LastEvaluatedKey) > 0),
+			)
+		case *dynamodb.ScanOutput:
+			span.SetAttributes(
+				attribute.Int64("aws.dynamodb.count", aws.Int64Value(out.Count)),
+				attribute.Int64("aws.dynamodb.scanned_count", aws.Int64Value(out.ScannedCount)),
+				attribute.Bool("aws.dynamodb.more_pages", len(out.LastEvaluatedKey) > 0),
+			)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// httpClient returns the http client for the aws calls, with --proxy and
+// --ca-bundle applied, or nil (the sdk's default) if neither is set. Without
+// --proxy, the HTTPS_PROXY/NO_PROXY environment variables are honored.
+func httpClient(proxy, cabundle string) (*http.Client, error) {
+	if proxy == "" && cabundle == "" {
+		return nil, nil
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return nil, usageErrorf("invalid --proxy format: %v", proxy)
+		}
+
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	if cabundle != "" {
+		pem, err := os.ReadFile(cabundle)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %v", cabundle)
+		}
+
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: tr}, nil
+}
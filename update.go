@@ -0,0 +1,304 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const releasesURL = "https://api.github.com/repos/flowerinthenight/lsdy/releases/latest"
+
+var (
+	updchk bool
+
+	updateCmd = &cobra.Command{
+		Use:   "update [flags]",
+		Short: "replace this binary with the latest release",
+		Long: `Download the latest release from GitHub for this os/arch, verify its sha256
+against the release's checksums.txt, and replace this binary in place. With
+--check, only report whether a newer release exists. Binaries installed with
+Homebrew are left to 'brew upgrade lsdy'. The --proxy and --ca-bundle flags apply.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               updateCmdRun,
+	}
+)
+
+// release is the part of a GitHub release we use.
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// asset returns the download url of the named asset, or an empty string.
+func (r *release) asset(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+
+	return ""
+}
+
+// newer reports whether the release is newer than this binary.
+func (r *release) newer() bool { return newerVersion(r.Tag, version) }
+
+// semver parses a vX.Y.Z version; the v is optional, and a -pre or +build
+// suffix is ignored.
+func semver(v string) ([3]int, bool) {
+	var n [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+
+	f := strings.Split(v, ".")
+	if len(f) != 3 {
+		return n, false
+	}
+
+	for i := range f {
+		x, err := strconv.Atoi(f[i])
+		if err != nil || x < 0 {
+			return n, false
+		}
+
+		n[i] = x
+	}
+
+	return n, true
+}
+
+// newerVersion reports whether tag is a strictly greater release than cur. Dev
+// (or otherwise unversioned) builds are behind every release, and a tag that
+// doesn't parse is never newer.
+func newerVersion(tag, cur string) bool {
+	t, ok := semver(tag)
+	if !ok {
+		return false
+	}
+
+	c, ok := semver(cur)
+	if !ok {
+		return true
+	}
+
+	for i := range t {
+		if t[i] != c[i] {
+			return t[i] > c[i]
+		}
+	}
+
+	return false
+}
+
+// fetch gets url with the --proxy/--ca-bundle flags applied.
+func fetch(url string) ([]byte, error) {
+	hc, err := httpClient(proxy, cabundle)
+	if err != nil {
+		return nil, err
+	}
+
+	if hc == nil {
+		hc = &http.Client{}
+	}
+
+	hc.Timeout = 5 * time.Minute
+	resp, err := hc.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", url, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// latestRelease returns the latest lsdy release on GitHub.
+func latestRelease() (*release, error) {
+	b, err := fetch(releasesURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var r release
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("%v: %v", releasesURL, err)
+	}
+
+	return &r, nil
+}
+
+// checksum returns the sha256 of name in a checksums.txt file.
+func checksum(sums []byte, name string) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(sums))
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) == 2 && f[1] == name {
+			return f[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("no checksum for %v", name)
+}
+
+// untarBinary returns the lsdy binary within a .tar.gz archive.
+func untarBinary(b []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no lsdy binary in the archive")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if filepath.Base(h.Name) == "lsdy" && h.Typeflag == tar.TypeReg {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+func updateCmdRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	fs := cmdFlags(cmd)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() > 0 {
+		return usageErrorf("unexpected arguments: %v", fs.Args())
+	}
+
+	log.SetFlags(0)
+	if cfgfile != "" {
+		if _, err := loadConfig(rootCmd.Flags(), cfgfile, fs.Changed("config")); err != nil {
+			return err
+		}
+	}
+
+	r, err := latestRelease()
+	if err != nil {
+		return err
+	}
+
+	if !r.newer() {
+		log.Printf("lsdy %v is the latest release\n", version)
+		return nil
+	}
+
+	if updchk {
+		log.Printf("lsdy %v is available (this is %v), run 'lsdy update' to install it\n", r.Tag, version)
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(exe, "/Cellar/") {
+		return fmt.Errorf("%v is installed with homebrew, use 'brew upgrade lsdy' instead", exe)
+	}
+
+	// goreleaser's default archive name.
+	name := fmt.Sprintf("lsdy_%v_%v_%v.tar.gz", strings.TrimPrefix(r.Tag, "v"), runtime.GOOS, runtime.GOARCH)
+	url, sumurl := r.asset(name), r.asset("checksums.txt")
+	switch {
+	case url == "":
+		return fmt.Errorf("release %v has no %v/%v binary (%v)", r.Tag, runtime.GOOS, runtime.GOARCH, name)
+	case sumurl == "":
+		return fmt.Errorf("release %v has no checksums.txt, not updating", r.Tag)
+	}
+
+	sums, err := fetch(sumurl)
+	if err != nil {
+		return err
+	}
+
+	want, err := checksum(sums, name)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("downloading %v\n", url)
+	b, err := fetch(url)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("%v: sha256 mismatch: got %v, want %v", name, got, want)
+	}
+
+	bin, err := untarBinary(b)
+	if err != nil {
+		return err
+	}
+
+	// Rename within the same directory, so the swap is atomic.
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".lsdy-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return err
+	}
+
+	log.Printf("updated %v from %v to %v\n", exe, version, r.Tag)
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestNewerVersion(t *testing.T) {
+	for _, tc := range []struct {
+		tag, cur string
+		want     bool
+	}{
+		{"v1.2.3", "v1.2.3", false},
+		{"1.2.3", "v1.2.3", false},
+		{"v1.2.2", "v1.2.3", false},
+		{"v1.1.9", "v1.2.0", false},
+		{"v0.9.0", "v1.0.0", false},
+		{"v1.2.4", "v1.2.3", true},
+		{"v1.3.0", "v1.2.9", true},
+		{"v2.0.0", "v1.10.10", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.2.3", "v1.2.3-rc1", false},
+		{"v1.2.3", "dev", true},
+		{"", "dev", false},
+		{"latest", "v1.2.3", false},
+		{"v1.2", "v1.0.0", false},
+	} {
+		if got := newerVersion(tc.tag, tc.cur); got != tc.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", tc.tag, tc.cur, got, tc.want)
+		}
+	}
+}
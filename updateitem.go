@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lappend  []string
+	sdelete  []string
+	updexist bool
+
+	updateItemCmd = &cobra.Command{
+		Use:   "update-item <table> --pk <attr:value> [--sk <attr:value>] [flags]",
+		Short: "edit the list, and set attributes of an item",
+		Long: `Edit the collection attributes of the item with the --pk (and --sk) key, in a
+single update, and print their new values:
+
+  --list-append attr=value   append the value to the list attribute (created
+                             if missing)
+  --set-delete attr=value    remove the value from the string (or number) set
+                             attribute
+
+Both can be repeated, for several values, or attributes. Values that look like
+numbers (or booleans) are used as such, unless quoted, i.e. 'codes="42"', as in
+--filter. A missing item is created (with --list-append), unless --exists is set.
+
+  lsdy update-item jobs --pk id:j1 --list-append 'log=retried' --set-delete 'tags=stuck'`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               updateItemQueryCmd,
+	}
+)
+
+// splitUpdate groups the values of an update flag, fmt: <attr=value>, by
+// attribute, in order.
+func splitUpdate(flag string, vals []string) (map[string][]*dynamodb.AttributeValue, error) {
+	m := make(map[string][]*dynamodb.AttributeValue)
+	for _, v := range vals {
+		sp := strings.SplitN(v, "=", 2)
+		if len(sp) != 2 || sp[0] == "" {
+			return nil, usageErrorf("invalid --%v format: %v", flag, v)
+		}
+
+		m[sp[0]] = append(m[sp[0]], filterValue(sp[1]))
+	}
+
+	return m, nil
+}
+
+// setValue returns vals as a string, or number set.
+func setValue(attr string, vals []*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	set := &dynamodb.AttributeValue{}
+	for _, v := range vals {
+		switch {
+		case v.S != nil && set.NS == nil:
+			set.SS = append(set.SS, v.S)
+		case v.N != nil && set.SS == nil:
+			set.NS = append(set.NS, v.N)
+		default:
+			return nil, usageErrorf("--set-delete values of %v are not all strings, or all numbers", attr)
+		}
+	}
+
+	return set, nil
+}
+
+func updateItemQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	svc, t, err := tableArg(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if len(lappend) == 0 && len(sdelete) == 0 {
+		return usageErrorf("expecting --list-append, or --set-delete")
+	}
+
+	key, err := keyFlags(t)
+	if err != nil {
+		return err
+	}
+
+	appends, err := splitUpdate("list-append", lappend)
+	if err != nil {
+		return err
+	}
+
+	deletes, err := splitUpdate("set-delete", sdelete)
+	if err != nil {
+		return err
+	}
+
+	var attrs []string
+	var ub expression.UpdateBuilder
+	for _, a := range sortedKeys(appends) {
+		name := expression.Name(a)
+		empty := expression.Value(&dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}})
+		ub = ub.Set(name, expression.ListAppend(expression.IfNotExists(name, empty), expression.Value(&dynamodb.AttributeValue{L: appends[a]})))
+		attrs = append(attrs, a)
+	}
+
+	for _, a := range sortedKeys(deletes) {
+		if _, ok := appends[a]; ok {
+			return usageErrorf("%v is in both --list-append, and --set-delete", a)
+		}
+
+		set, err := setValue(a, deletes[a])
+		if err != nil {
+			return err
+		}
+
+		ub = ub.Delete(expression.Name(a), expression.Value(set))
+		attrs = append(attrs, a)
+	}
+
+	b := expression.NewBuilder().WithUpdate(ub)
+	if updexist {
+		hash, _ := keyNames(t.KeySchema)
+		b = b.WithCondition(expression.AttributeExists(expression.Name(hash)))
+	}
+
+	expr, err := b.Build()
+	if err != nil {
+		return usageError(err)
+	}
+
+	table := aws.StringValue(t.TableName)
+	out, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 t.TableName,
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return &codeError{exitNotFound, fmt.Errorf("%v: no item %v", table, strings.Join(append(pk[:1:1], sk...), ", "))}
+		}
+
+		return err
+	}
+
+	audit(table, "update-item", 1, 0, changedFlags(cmdFlags(cmd), "config", "no-history"))
+	var m map[string]interface{}
+	if err := dynamodbattribute.UnmarshalMap(out.Attributes, &m); err != nil {
+		return err
+	}
+
+	// A set emptied by --set-delete is removed.
+	for _, v := range attrs {
+		if val, ok := lsdy.LookupPath(m, v); ok {
+			fmt.Printf("%v: %v\n", v, fmtval(val))
+		} else {
+			fmt.Printf("%v: -\n", v)
+		}
+	}
+
+	return nil
+}
+
+// sortedKeys returns the keys of m, sorted.
+func sortedKeys(m map[string][]*dynamodb.AttributeValue) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
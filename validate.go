@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// validator checks items against the --validate json schema.
+type validator struct {
+	schema *jsonschema.Schema
+	pklbl  string
+	sklbl  string
+}
+
+func newValidator(file, pklbl, sklbl string) (*validator, error) {
+	s, err := jsonschema.Compile(file)
+	if err != nil {
+		return nil, usageErrorf("invalid --validate schema: %v", err)
+	}
+
+	return &validator{schema: s, pklbl: pklbl, sklbl: sklbl}, nil
+}
+
+// key returns the primary key of item, for the report.
+func (v *validator) key(item map[string]interface{}) string {
+	k := fmt.Sprintf("%v=%v", v.pklbl, item[v.pklbl])
+	if v.sklbl != "" {
+		k += fmt.Sprintf(", %v=%v", v.sklbl, item[v.sklbl])
+	}
+
+	return k
+}
+
+// check validates each item (as the json of --detail), and logs the violations
+// of the invalid ones, one line each, by key. It returns the number of invalid
+// items.
+func (v *validator) check(items []map[string]interface{}) (int, error) {
+	var invalid int
+	for _, item := range items {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return invalid, err
+		}
+
+		// The validator wants json numbers, not float64s.
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		var doc interface{}
+		if err := d.Decode(&doc); err != nil {
+			return invalid, err
+		}
+
+		err = v.schema.Validate(doc)
+		var ve *jsonschema.ValidationError
+		switch {
+		case err == nil:
+			continue
+		case !errors.As(err, &ve):
+			return invalid, err
+		}
+
+		invalid++
+		var msgs []string
+		var leaves func(*jsonschema.ValidationError)
+		leaves = func(e *jsonschema.ValidationError) {
+			if len(e.Causes) == 0 {
+				loc := e.InstanceLocation
+				if loc == "" {
+					loc = "/"
+				}
+
+				msgs = append(msgs, fmt.Sprintf("%v: %v", loc, e.Message))
+			}
+
+			for _, c := range e.Causes {
+				leaves(c)
+			}
+		}
+
+		leaves(ve)
+		log.Printf("invalid: %v: %v\n", v.key(item), strings.Join(msgs, "; "))
+	}
+
+	return invalid, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Set by goreleaser, or i.e. go build -ldflags "-X main.version=v1.2.3 -X
+// main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)".
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "print the version, commit, and build date",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("lsdy %v\ncommit: %v\nbuilt: %v\ngo: %v %v/%v\n", version, commit, date,
+			runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	},
+}
+
+// updateState is the last update check, see checkUpdate.
+type updateState struct {
+	Checked time.Time `json:"checked"`
+	Latest  string    `json:"latest"`
+}
+
+// updateEvery is how often checkUpdate asks GitHub for the latest release.
+const updateEvery = 24 * time.Hour
+
+// checkUpdate notes (on stderr) when a newer release than this binary is known,
+// and refreshes what's known in the background, at most once a day, so that it
+// never delays the command. Skipped for dev builds, when stderr is not a terminal
+// (i.e. in scripts), and with LSDY_NO_UPDATE_CHECK set.
+func checkUpdate() {
+	switch {
+	case version == "dev", os.Getenv("LSDY_NO_UPDATE_CHECK") != "":
+		return
+	case !term.IsTerminal(int(os.Stderr.Fd())):
+		return
+	case len(os.Args) > 1 && strings.HasPrefix(os.Args[1], "__complete"):
+		return
+	case len(os.Args) > 1 && (os.Args[1] == "update" || os.Args[1] == "version"):
+		return
+	}
+
+	file := filepath.Join(cacheDir(), "update.json")
+	var st updateState
+	readJSON(file, &st)
+	if newerVersion(st.Latest, version) {
+		log.SetFlags(0)
+		log.Printf("note: lsdy %v is available (this is %v), run 'lsdy update' (or set LSDY_NO_UPDATE_CHECK=1 to silence this)\n",
+			st.Latest, version)
+	}
+
+	if time.Since(st.Checked) < updateEvery {
+		return
+	}
+
+	// Not waited for; if the command ends first, the next one checks again.
+	go func() {
+		r, err := latestRelease()
+		if err != nil {
+			return
+		}
+
+		writeJSON(file, updateState{Checked: time.Now().UTC(), Latest: r.Tag})
+	}()
+}
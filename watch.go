@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/flowerinthenight/lsdy/pkg/lsdy"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// watchState keeps the rows of the previous --watch run, keyed by the item's
+// primary key (or by all its values if there is no key), to mark the rows that
+// are new (+), changed (~), or removed (-).
+type watchState struct {
+	n    int // number of runs so far
+	prev map[string]lsdy.Row
+	keys []string // prev keys, in display order
+}
+
+var wstate *watchState
+
+// watchRun calls run every --watch interval until interrupted.
+func watchRun(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	wstate = &watchState{}
+	tty := term.IsTerminal(int(os.Stdout.Fd()))
+	for {
+		if tty {
+			fmt.Print("\033[H\033[2J") // clear screen
+		}
+
+		log.Printf("Every %v: %v (%v)\n", watch, strings.Join(os.Args, " "), time.Now().Format(time.RFC3339))
+		if err := run(cmd, args); err != nil {
+			log.Println(err)
+		}
+
+		wstate.n++
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watch):
+		}
+	}
+}
+
+// rowKey returns the identity of r across runs, the values of all the columns
+// cols if there is no key.
+func rowKey(r lsdy.Row, cols []string, pklbl, sklbl string) string {
+	if _, ok := r.Item[pklbl]; !ok {
+		return lsdy.DedupeKey(r, cols, lsdy.Format{})
+	}
+
+	return fmt.Sprintf("%v\x00%v", r.Item[pklbl], r.Item[sklbl])
+}
+
+// diff marks the rows compared to the previous run, appends the removed ones,
+// and remembers the rows for the next run. The marks are prepended to the cells
+// as a new column. Nothing is marked on the first run.
+func (w *watchState) diff(rows []lsdy.Row, cols []string, pklbl, sklbl string) []lsdy.Row {
+	cur := make(map[string]lsdy.Row)
+	var keys []string
+	var out []lsdy.Row
+	for _, r := range rows {
+		k := rowKey(r, cols, pklbl, sklbl)
+		for i := 1; ; i++ { // i.e. rows from --explode
+			if _, ok := cur[k]; !ok {
+				break
+			}
+
+			k = fmt.Sprintf("%v\x00#%v", rowKey(r, cols, pklbl, sklbl), i)
+		}
+
+		cur[k] = r
+		keys = append(keys, k)
+		mark := ""
+		if p, ok := w.prev[k]; !ok && w.n > 0 {
+			mark = "+"
+		} else if ok && strings.Join(p.Cells, "\x00") != strings.Join(r.Cells, "\x00") {
+			mark = "~"
+		}
+
+		r.Mark = mark
+		r.Cells = append([]string{mark}, r.Cells...)
+		out = append(out, r)
+	}
+
+	for _, k := range w.keys {
+		if _, ok := cur[k]; ok {
+			continue
+		}
+
+		r := w.prev[k]
+		r.Mark = "-"
+		r.Cells = append([]string{"-"}, r.Cells...)
+		out = append(out, r)
+	}
+
+	w.prev, w.keys = cur, keys
+	return out
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	wbsample int64
+	wbname   string
+
+	workbenchCmd = &cobra.Command{
+		Use:   "workbench <table> [flags]",
+		Short: "export the table design, and sample items, as a nosql workbench data model",
+		Long: `Print a NoSQL Workbench data model (json, to import with 'Import data model')
+of the table: its keys, secondary indexes, capacity settings, a facet, and the
+non-key attributes and first --sample items of a scan as the table data. The type
+of a non-key attribute is the most common one in the sample.`,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               workbenchQueryCmd,
+	}
+)
+
+// wbAttr is a workbench attribute definition.
+type wbAttr struct {
+	AttributeName string
+	AttributeType string
+}
+
+// avType returns the DynamoDB JSON type of v, i.e. S, N, M.
+func avType(v *dynamodb.AttributeValue) string {
+	for k := range avJSON(v) {
+		return k
+	}
+
+	return ""
+}
+
+// wbKeys returns the workbench KeyAttributes of a key schema.
+func wbKeys(keys []*dynamodb.KeySchemaElement, types map[string]string) map[string]wbAttr {
+	out := make(map[string]wbAttr)
+	for _, k := range keys {
+		a := wbAttr{aws.StringValue(k.AttributeName), types[aws.StringValue(k.AttributeName)]}
+		if aws.StringValue(k.KeyType) == dynamodb.KeyTypeHash {
+			out["PartitionKey"] = a
+		} else {
+			out["SortKey"] = a
+		}
+	}
+
+	return out
+}
+
+func workbenchQueryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+
+	t, items, err := sampleItems(cmd, args, wbsample)
+	if err != nil {
+		return err
+	}
+
+	table := aws.StringValue(t.TableName)
+	types := make(map[string]string) // key attributes
+	for _, v := range t.AttributeDefinitions {
+		types[aws.StringValue(v.AttributeName)] = aws.StringValue(v.AttributeType)
+	}
+
+	// The most common type of each non-key attribute.
+	counts := make(map[string]map[string]int)
+	for _, item := range items {
+		for k, v := range item {
+			if _, ok := types[k]; ok {
+				continue
+			}
+
+			if counts[k] == nil {
+				counts[k] = make(map[string]int)
+			}
+
+			counts[k][avType(v)]++
+		}
+	}
+
+	nonkey := []wbAttr{}
+	for k, c := range counts {
+		best := ""
+		for typ, n := range c {
+			if best == "" || n > c[best] || (n == c[best] && typ < best) {
+				best = typ
+			}
+		}
+
+		nonkey = append(nonkey, wbAttr{k, best})
+	}
+
+	sort.Slice(nonkey, func(i, j int) bool { return nonkey[i].AttributeName < nonkey[j].AttributeName })
+
+	keys := wbKeys(t.KeySchema, types)
+	alias := make(map[string]string)
+	if v, ok := keys["PartitionKey"]; ok {
+		alias["PartitionKeyAlias"] = v.AttributeName
+	}
+
+	if v, ok := keys["SortKey"]; ok {
+		alias["SortKeyAlias"] = v.AttributeName
+	}
+
+	var nonkeyNames []string
+	for _, v := range nonkey {
+		nonkeyNames = append(nonkeyNames, v.AttributeName)
+	}
+
+	var gsis []map[string]interface{}
+	for _, v := range t.GlobalSecondaryIndexes {
+		proj := map[string]interface{}{"ProjectionType": aws.StringValue(v.Projection.ProjectionType)}
+		if len(v.Projection.NonKeyAttributes) > 0 {
+			proj["NonKeyAttributes"] = aws.StringValueSlice(v.Projection.NonKeyAttributes)
+		}
+
+		gsis = append(gsis, map[string]interface{}{
+			"IndexName":     aws.StringValue(v.IndexName),
+			"KeyAttributes": wbKeys(v.KeySchema, types),
+			"Projection":    proj,
+		})
+	}
+
+	data := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		data[i] = avItem(item)
+	}
+
+	tm := map[string]interface{}{
+		"TableName":        table,
+		"KeyAttributes":    keys,
+		"NonKeyAttributes": nonkey,
+		"TableFacets": []map[string]interface{}{{
+			"FacetName":         table,
+			"KeyAttributeAlias": alias,
+			"TableData":         []interface{}{},
+			"NonKeyAttributes":  nonkeyNames,
+			"DataAccess":        map[string]interface{}{"MySql": map[string]interface{}{}},
+		}},
+		"TableData":   data,
+		"DataAccess":  map[string]interface{}{"MySql": map[string]interface{}{}},
+		"BillingMode": dynamodb.BillingModeProvisioned,
+	}
+
+	if len(gsis) > 0 {
+		tm["GlobalSecondaryIndexes"] = gsis
+	}
+
+	if t.BillingModeSummary != nil && aws.StringValue(t.BillingModeSummary.BillingMode) == dynamodb.BillingModePayPerRequest {
+		tm["BillingMode"] = dynamodb.BillingModePayPerRequest
+	} else if t.ProvisionedThroughput != nil {
+		tm["ProvisionedCapacitySettings"] = map[string]interface{}{
+			"ProvisionedThroughput": map[string]int64{
+				"ReadCapacityUnits":  aws.Int64Value(t.ProvisionedThroughput.ReadCapacityUnits),
+				"WriteCapacityUnits": aws.Int64Value(t.ProvisionedThroughput.WriteCapacityUnits),
+			},
+		}
+	}
+
+	name := wbname
+	if name == "" {
+		name = table
+	}
+
+	now := time.Now().Format("Jan 02, 2006, 03:04 PM")
+	model := map[string]interface{}{
+		"ModelName": name,
+		"ModelMetadata": map[string]string{
+			"Author":           "",
+			"DateCreated":      now,
+			"DateLastModified": now,
+			"Description":      "exported by lsdy",
+			"AWSService":       "Amazon DynamoDB",
+			"Version":          "3.0",
+		},
+		"DataModel": []interface{}{tm},
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(model)
+}